@@ -1,8 +1,11 @@
 package common
 
 import (
+	"encoding/binary"
 	"errors"
+	"math"
 	"strconv"
+	"strings"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/boltdb/bolt"
@@ -30,6 +33,17 @@ var (
 	ErrNoIDInTheElement = errors.New("no id in element")
 )
 
+// BytesToFloat converts bytes created by FloatToBytes back to float64
+func BytesToFloat(b []byte) float64 {
+	bits := binary.BigEndian.Uint64(b)
+	if bits&(1<<63) != 0 {
+		bits ^= 1 << 63
+	} else {
+		bits = ^bits
+	}
+	return math.Float64frombits(bits)
+}
+
 // BytesToSeq converts []byte implementation of sequence to uint64
 func BytesToSeq(b []byte) (seq uint64) {
 	seq, err := strconv.ParseUint(string(b), 10, 64)
@@ -39,6 +53,24 @@ func BytesToSeq(b []byte) (seq uint64) {
 	return seq
 }
 
+// DeleteField removes property of the passed map by the dot separated path.
+// Parent maps which become empty are removed too.
+func DeleteField(data map[string]interface{}, path string) {
+	parts := strings.Split(path, ".")
+	if len(parts) > 1 {
+		next, ok := data[parts[0]].(map[string]interface{})
+		if !ok {
+			return
+		}
+		DeleteField(next, strings.Join(parts[1:], "."))
+		if len(next) == 0 {
+			delete(data, parts[0])
+		}
+		return
+	}
+	delete(data, path)
+}
+
 // ExtractID returns _id property of the passed interface{} if it is a map[string]interface{}
 func ExtractID(data interface{}) (string, bool) {
 	if m, ok := data.(map[string]interface{}); ok && m["_id"] != nil {
@@ -49,6 +81,37 @@ func ExtractID(data interface{}) (string, bool) {
 	return "", false
 }
 
+// FloatToBytes converts float64 to 8 bytes which are sorted in the same order as numbers.
+// Negative zero is encoded as zero, because they are equal numbers.
+func FloatToBytes(f float64) []byte {
+	if f == 0 {
+		f = 0
+	}
+	bits := math.Float64bits(f)
+	if !math.Signbit(f) {
+		bits ^= 1 << 63
+	} else {
+		bits = ^bits
+	}
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, bits)
+	return b
+}
+
+// GetField returns property of the passed interface{} by the dot separated path, e.g. "user.email"
+func GetField(data interface{}, path string) (interface{}, bool) {
+	for _, p := range strings.Split(path, ".") {
+		m, ok := data.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if data, ok = m[p]; !ok {
+			return nil, false
+		}
+	}
+	return data, true
+}
+
 // GetEncodedSeqByID returns []byte representation of the item sequence key by item _id property
 func GetEncodedSeqByID(queue string, id []byte, b *bolt.Bucket) ([]byte, error) {
 	sb := b.Bucket(IDToSeqBucket)
@@ -67,6 +130,35 @@ func IntToUint(i int) uint64 {
 	return ZeroPoint + uint64(i)
 }
 
+// Project returns copy of the passed map with only provided properties.
+// Returns data untouched if it is not a map[string]interface{}
+func Project(data interface{}, fields []string) interface{} {
+	if _, ok := data.(map[string]interface{}); !ok {
+		return data
+	}
+	res := map[string]interface{}{}
+	for _, f := range fields {
+		if v, ok := GetField(data, f); ok {
+			SetField(res, f, v)
+		}
+	}
+	return res
+}
+
+// SetField sets property of the passed map by the dot separated path, creating nested maps if needed
+func SetField(data map[string]interface{}, path string, value interface{}) {
+	parts := strings.Split(path, ".")
+	for _, p := range parts[:len(parts)-1] {
+		next, ok := data[p].(map[string]interface{})
+		if !ok {
+			next = map[string]interface{}{}
+			data[p] = next
+		}
+		data = next
+	}
+	data[parts[len(parts)-1]] = value
+}
+
 // SetSeqToIDRef creates index records when key is a sequence and value is a item _id
 func SetSeqToIDRef(seq, id []byte, b *bolt.Bucket) error {
 	sb, err := b.CreateBucketIfNotExists(IDToSeqBucket)
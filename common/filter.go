@@ -0,0 +1,224 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// ErrInvalidFilter returns when filter contains unknown operator or operator with invalid argument
+var ErrInvalidFilter = errors.New("invalid filter")
+
+// Match reports whether data matches the filter. Filter is a mongo-like query where keys are dot separated paths
+// to the properties, e.g. {"status": "active", "age": {"$gte": 18}, "$or": [{"role": "admin"}, {"tags": {"$in": ["a", "b"]}}]}
+// Supported operators are $eq, $ne, $gt, $gte, $lt, $lte, $in, $nin, $exists, $and, $or.
+func Match(data interface{}, filter map[string]interface{}) (bool, error) {
+	for k, cond := range filter {
+		var ok bool
+		var err error
+		switch k {
+		case "$and", "$or":
+			ok, err = matchLogical(data, k == "$and", cond)
+		default:
+			v, exists := GetField(data, k)
+			ok, err = matchCondition(v, exists, cond)
+		}
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// ValidateFilter checks that filter contains only supported operators with valid arguments
+func ValidateFilter(filter map[string]interface{}) error {
+	for k, cond := range filter {
+		switch k {
+		case "$and", "$or":
+			conds, ok := cond.([]interface{})
+			if !ok {
+				return ErrInvalidFilter
+			}
+			for _, c := range conds {
+				f, ok := c.(map[string]interface{})
+				if !ok {
+					return ErrInvalidFilter
+				}
+				if err := ValidateFilter(f); err != nil {
+					return err
+				}
+			}
+		default:
+			ops, ok := operators(cond)
+			if !ok {
+				continue
+			}
+			for op, arg := range ops {
+				if _, err := matchOperator(nil, false, op, arg); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Compare compares two numbers or two strings. Returns false if values are not comparable.
+func Compare(a, b interface{}) (int, bool) {
+	if x, ok := ToFloat(a); ok {
+		y, ok := ToFloat(b)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		}
+		return 0, true
+	}
+	if x, ok := a.(string); ok {
+		y, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+		return strings.Compare(x, y), true
+	}
+	return 0, false
+}
+
+// Equal reports whether two values have the same JSON representation
+func Equal(a, b interface{}) bool {
+	if x, ok := ToFloat(a); ok {
+		y, ok := ToFloat(b)
+		return ok && x == y
+	}
+	x, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	y, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return string(x) == string(y)
+}
+
+// ToFloat converts numeric value to float64
+func ToFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	case uint:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+func matchLogical(data interface{}, and bool, cond interface{}) (bool, error) {
+	conds, ok := cond.([]interface{})
+	if !ok {
+		return false, ErrInvalidFilter
+	}
+	for _, c := range conds {
+		f, ok := c.(map[string]interface{})
+		if !ok {
+			return false, ErrInvalidFilter
+		}
+		matched, err := Match(data, f)
+		if err != nil {
+			return false, err
+		}
+		if matched != and {
+			return matched, nil
+		}
+	}
+	return and, nil
+}
+
+func matchCondition(v interface{}, exists bool, cond interface{}) (bool, error) {
+	ops, ok := operators(cond)
+	if !ok {
+		return exists && Equal(v, cond), nil
+	}
+	for op, arg := range ops {
+		matched, err := matchOperator(v, exists, op, arg)
+		if err != nil || !matched {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func matchOperator(v interface{}, exists bool, op string, arg interface{}) (bool, error) {
+	switch op {
+	case "$eq":
+		return exists && Equal(v, arg), nil
+	case "$ne":
+		return !exists || !Equal(v, arg), nil
+	case "$gt", "$gte", "$lt", "$lte":
+		if !exists {
+			return false, nil
+		}
+		c, ok := Compare(v, arg)
+		if !ok {
+			return false, nil
+		}
+		switch op {
+		case "$gt":
+			return c > 0, nil
+		case "$gte":
+			return c >= 0, nil
+		case "$lt":
+			return c < 0, nil
+		}
+		return c <= 0, nil
+	case "$in", "$nin":
+		values, ok := arg.([]interface{})
+		if !ok {
+			return false, ErrInvalidFilter
+		}
+		var found bool
+		for _, value := range values {
+			if exists && Equal(v, value) {
+				found = true
+				break
+			}
+		}
+		return found == (op == "$in"), nil
+	case "$exists":
+		expected, ok := arg.(bool)
+		if !ok {
+			return false, ErrInvalidFilter
+		}
+		return exists == expected, nil
+	}
+	return false, ErrInvalidFilter
+}
+
+// operators returns condition as operators map if all it's keys are operators
+func operators(cond interface{}) (map[string]interface{}, bool) {
+	ops, ok := cond.(map[string]interface{})
+	if !ok || len(ops) == 0 {
+		return nil, false
+	}
+	for k := range ops {
+		if !strings.HasPrefix(k, "$") {
+			return nil, false
+		}
+	}
+	return ops, true
+}
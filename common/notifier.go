@@ -0,0 +1,37 @@
+package common
+
+import "sync"
+
+// Notifier wakes up goroutines waiting for changes of the named entities, e.g. queues or lists
+type Notifier struct {
+	chans map[string]chan struct{}
+	sync.Mutex
+}
+
+// NewNotifier creates new Notifier
+func NewNotifier() *Notifier {
+	return &Notifier{chans: map[string]chan struct{}{}}
+}
+
+// Wait returns channel that will be closed on the next Notify call for the provided name.
+// Wait must be called before checking the entity state to not miss notification.
+func (n *Notifier) Wait(name string) <-chan struct{} {
+	n.Lock()
+	defer n.Unlock()
+	ch, ok := n.chans[name]
+	if !ok {
+		ch = make(chan struct{})
+		n.chans[name] = ch
+	}
+	return ch
+}
+
+// Notify wakes up all goroutines waiting for the provided name
+func (n *Notifier) Notify(name string) {
+	n.Lock()
+	defer n.Unlock()
+	if ch, ok := n.chans[name]; ok {
+		close(ch)
+		delete(n.chans, name)
+	}
+}
@@ -1,8 +1,10 @@
 package intranet
 
 import (
+	"encoding/json"
 	"errors"
 	"net/http"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/getblank/wango"
@@ -10,8 +12,12 @@ import (
 
 	"github.com/getblank/blank-queue/lists"
 	"github.com/getblank/blank-queue/queue"
+	"github.com/getblank/blank-queue/zsets"
 )
 
+// listRemappedURI is the topic for the sequence number mappings of the elements shifted by inserts, moves and compaction
+const listRemappedURI = "list.remapped"
+
 var (
 	wampServer          = wango.New()
 	errInvalidArguments = errors.New("invalid arguments")
@@ -51,6 +57,37 @@ func queueShiftHandler(c *wango.Conn, _uri string, args ...interface{}) (interfa
 	return res, err
 }
 
+// args: queue string, limit float64, maxWait float64 (milliseconds), groupKey string (optional)
+func queueShiftBatchHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("ShiftBatch request arrived")
+	if len(args) < 3 {
+		return nil, errInvalidArguments
+	}
+	q, ok := args[0].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	limit, ok := args[1].(float64)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	maxWait, ok := args[2].(float64)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	var groupKey string
+	if len(args) > 3 && args[3] != nil {
+		if groupKey, ok = args[3].(string); !ok {
+			return nil, errInvalidArguments
+		}
+	}
+	res, err := queue.ShiftBatch(q, int(limit), time.Duration(maxWait*float64(time.Millisecond)), groupKey)
+	if err != nil {
+		log.WithError(err).Debug("Can't shift batch")
+	}
+	return res, err
+}
+
 // args: queue string, data interface{},
 func queueUnshiftHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
 	log.WithField("args", args).Debug("Unshift request arrived")
@@ -139,6 +176,205 @@ func queueGetHandler(c *wango.Conn, _uri string, args ...interface{}) (interface
 	return data, err
 }
 
+// args: queue string, data interface{}, policy map[string]interface{} (optional)
+func queueNackHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("Nack request arrived")
+	if len(args) < 2 {
+		return nil, errInvalidArguments
+	}
+	q, ok := args[0].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	var policy *queue.RetryPolicy
+	if len(args) > 2 && args[2] != nil {
+		policy = new(queue.RetryPolicy)
+		if err := decodeArg(args[2], policy); err != nil {
+			return nil, err
+		}
+	}
+	attempt, delay, err := queue.Nack(q, args[1], policy)
+	if err != nil {
+		log.WithError(err).Debug("Can't nack item")
+		return nil, err
+	}
+	return m{"attempt": attempt, "delay": int64(delay / time.Millisecond)}, nil
+}
+
+// args: queue string, policy map[string]interface{}
+func queueSetRetryPolicyHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("SetRetryPolicy request arrived")
+	if len(args) < 2 {
+		return nil, errInvalidArguments
+	}
+	q, ok := args[0].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	var policy *queue.RetryPolicy
+	if args[1] != nil {
+		policy = new(queue.RetryPolicy)
+		if err := decodeArg(args[1], policy); err != nil {
+			return nil, err
+		}
+	}
+	err := queue.SetRetryPolicy(q, policy)
+	if err != nil {
+		log.WithError(err).Debug("Can't set retry policy")
+	}
+	return nil, err
+}
+
+// args: queue string, opts map[string]interface{}
+func queueSetCoalescingHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("SetCoalescing request arrived")
+	if len(args) < 2 {
+		return nil, errInvalidArguments
+	}
+	q, ok := args[0].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	var opts *queue.CoalesceOptions
+	if args[1] != nil {
+		opts = new(queue.CoalesceOptions)
+		if err := decodeArg(args[1], opts); err != nil {
+			return nil, err
+		}
+	}
+	err := queue.SetCoalescing(q, opts)
+	if err != nil {
+		log.WithError(err).Debug("Can't set coalescing")
+	}
+	return nil, err
+}
+
+// args: exchange string, binding map[string]interface{}
+func exchangeBindHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("Exchange Bind request arrived")
+	if len(args) < 2 {
+		return nil, errInvalidArguments
+	}
+	e, ok := args[0].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	binding := new(queue.Binding)
+	if err := decodeArg(args[1], binding); err != nil {
+		return nil, err
+	}
+	err := queue.Bind(e, binding)
+	if err != nil {
+		log.WithError(err).Debug("Can't bind queue")
+	}
+	return nil, err
+}
+
+// args: exchange, queue string
+func exchangeUnbindHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("Exchange Unbind request arrived")
+	if len(args) < 2 {
+		return nil, errInvalidArguments
+	}
+	e, ok := args[0].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	q, ok := args[1].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	err := queue.Unbind(e, q)
+	if err != nil {
+		log.WithError(err).Debug("Can't unbind queue")
+	}
+	return nil, err
+}
+
+// args: exchange string
+func exchangeBindingsHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("Exchange Bindings request arrived")
+	if len(args) == 0 {
+		return nil, errInvalidArguments
+	}
+	e, ok := args[0].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	res, err := queue.Bindings(e)
+	if err != nil {
+		log.WithError(err).Debug("Can't get bindings")
+	}
+	return res, err
+}
+
+// args: exchange, routingKey string, data interface{}
+func exchangePushHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("Exchange Push request arrived")
+	if len(args) < 3 {
+		return nil, errInvalidArguments
+	}
+	e, ok := args[0].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	var routingKey string
+	if args[1] != nil {
+		if routingKey, ok = args[1].(string); !ok {
+			return nil, errInvalidArguments
+		}
+	}
+	res, err := queue.PushToExchange(e, routingKey, args[2])
+	if err != nil {
+		log.WithError(err).Debug("Can't push item to exchange")
+	}
+	return res, err
+}
+
+// args: pipeline map[string]interface{}
+func pipelineCreateHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("Pipeline Create request arrived")
+	if len(args) == 0 {
+		return nil, errInvalidArguments
+	}
+	p := new(queue.Pipeline)
+	if err := decodeArg(args[0], p); err != nil {
+		return nil, err
+	}
+	err := queue.CreatePipeline(p)
+	if err != nil {
+		log.WithError(err).Debug("Can't create pipeline")
+	}
+	return nil, err
+}
+
+// args: name string
+func pipelineRemoveHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("Pipeline Remove request arrived")
+	if len(args) == 0 {
+		return nil, errInvalidArguments
+	}
+	name, ok := args[0].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	err := queue.RemovePipeline(name)
+	if err != nil {
+		log.WithError(err).Debug("Can't remove pipeline")
+	}
+	return nil, err
+}
+
+// args: none
+func pipelineListHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.Debug("Pipeline List request arrived")
+	res, err := queue.Pipelines()
+	if err != nil {
+		log.WithError(err).Debug("Can't get pipelines")
+	}
+	return res, err
+}
+
 type m map[string]interface{}
 
 // args: list string
@@ -213,112 +449,151 @@ func listPushFrontHandler(c *wango.Conn, _uri string, args ...interface{}) (inte
 	return n, err
 }
 
-// args: list string, n float64
-func listNextHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
-	log.WithField("args", args).Debug("List Next arrived")
-	if len(args) < 2 {
+// args: list string, n float64 or _id string, element interface{}
+func listInsertBeforeHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("List InsertBefore arrived")
+	if len(args) < 3 {
 		return nil, errInvalidArguments
 	}
 	l, ok := args[0].(string)
 	if !ok {
 		return nil, errInvalidArguments
 	}
-	_n, ok := args[1].(float64)
-	if !ok {
+	var n int
+	var err error
+	switch anchor := args[1].(type) {
+	case float64:
+		n, err = lists.InsertBefore(l, int(anchor), args[2])
+	case string:
+		n, err = lists.InsertBeforeByID(l, anchor, args[2])
+	default:
 		return nil, errInvalidArguments
 	}
-	e, n, err := lists.Next(l, int(_n))
 	if err != nil {
-		log.WithError(err).WithField("position", _n).Debug("Can't get next element")
+		log.WithError(err).WithField("anchor", args[1]).Debug("Can't insert element")
 		return nil, err
 	}
-	return m{"element": e, "position": n}, err
+	return n, err
 }
 
-// args: list string, n float64
-func listPrevHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
-	log.WithField("args", args).Debug("List Prev arrived")
-	if len(args) < 2 {
+// args: list string, n float64 or _id string, element interface{}
+func listInsertAfterHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("List InsertAfter arrived")
+	if len(args) < 3 {
 		return nil, errInvalidArguments
 	}
 	l, ok := args[0].(string)
 	if !ok {
 		return nil, errInvalidArguments
 	}
-	_n, ok := args[1].(float64)
-	if !ok {
+	var n int
+	var err error
+	switch anchor := args[1].(type) {
+	case float64:
+		n, err = lists.InsertAfter(l, int(anchor), args[2])
+	case string:
+		n, err = lists.InsertAfterByID(l, anchor, args[2])
+	default:
 		return nil, errInvalidArguments
 	}
-	e, n, err := lists.Prev(l, int(_n))
 	if err != nil {
-		log.WithError(err).WithField("position", _n).Debug("Can't get prev element")
+		log.WithError(err).WithField("anchor", args[1]).Debug("Can't insert element")
 		return nil, err
 	}
-	return m{"element": e, "position": n}, err
+	return n, err
 }
 
-// args: list string, n float64
-func listRemoveHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
-	log.WithField("args", args).Debug("List Remove arrived")
-	if len(args) < 2 {
+// args: list string, from float64 (optional), limit float64, direction string ("forward" or "backward", optional)
+func listRangeHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("List Range arrived")
+	if len(args) < 3 {
 		return nil, errInvalidArguments
 	}
 	l, ok := args[0].(string)
 	if !ok {
 		return nil, errInvalidArguments
 	}
-	_n, ok := args[1].(float64)
+	var from *int
+	if args[1] != nil {
+		_from, ok := args[1].(float64)
+		if !ok {
+			return nil, errInvalidArguments
+		}
+		n := int(_from)
+		from = &n
+	}
+	limit, ok := args[2].(float64)
 	if !ok {
 		return nil, errInvalidArguments
 	}
-	err := lists.Remove(l, int(_n))
+	var reverse bool
+	if len(args) > 3 && args[3] != nil {
+		switch args[3] {
+		case "forward":
+		case "backward":
+			reverse = true
+		default:
+			return nil, errInvalidArguments
+		}
+	}
+	items, next, err := lists.Range(l, from, int(limit), reverse)
 	if err != nil {
-		log.WithError(err).WithField("position", _n).Debug("Can't remove element")
+		log.WithError(err).Debug("Can't get range of elements")
+		return nil, err
 	}
-	return nil, err
+	return m{"items": items, "next": next}, nil
 }
 
-// args: list string, _id string
-func listRemoveByIDHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
-	log.WithField("args", args).Debug("List RemoveByID arrived")
-	if len(args) < 2 {
+// args: list string, offset float64, limit float64
+func listSliceHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("List Slice arrived")
+	if len(args) < 3 {
 		return nil, errInvalidArguments
 	}
 	l, ok := args[0].(string)
 	if !ok {
 		return nil, errInvalidArguments
 	}
-	_id, ok := args[1].(string)
+	offset, ok := args[1].(float64)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	limit, ok := args[2].(float64)
 	if !ok {
 		return nil, errInvalidArguments
 	}
-	err := lists.RemoveByID(l, _id)
+	items, err := lists.Slice(l, int(offset), int(limit))
 	if err != nil {
-		log.WithError(err).WithField("_id", _id).Debug("Can't remove element")
+		log.WithError(err).Debug("Can't get slice of elements")
 	}
-	return nil, err
+	return items, err
 }
 
-// args: list string
-func listDropHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
-	log.WithField("args", args).Debug("List Drop arrived")
-	if len(args) == 0 {
+// args: list string, index float64
+func listAtHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("List At arrived")
+	if len(args) < 2 {
 		return nil, errInvalidArguments
 	}
 	l, ok := args[0].(string)
 	if !ok {
 		return nil, errInvalidArguments
 	}
-	err := lists.Drop(l)
+	index, ok := args[1].(float64)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	e, n, err := lists.At(l, int(index))
 	if err != nil {
-		log.WithError(err).Debug("Can't drop list")
+		log.WithError(err).WithField("index", index).Debug("Can't get element by index")
+		return nil, err
 	}
-	return nil, err
+	return m{"element": e, "position": n}, err
 }
 
-// args: list string, n float64
-func listGetHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
-	log.WithField("args", args).Debug("List Get arrived")
+// args: list string, _id string
+func listRankHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("List Rank arrived")
 	if len(args) < 2 {
 		return nil, errInvalidArguments
 	}
@@ -326,20 +601,21 @@ func listGetHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{
 	if !ok {
 		return nil, errInvalidArguments
 	}
-	_n, ok := args[1].(float64)
+	_id, ok := args[1].(string)
 	if !ok {
 		return nil, errInvalidArguments
 	}
-	e, err := lists.Get(l, int(_n))
+	index, err := lists.Rank(l, _id)
 	if err != nil {
-		log.WithError(err).WithField("position", _n).Debug("Can't get element")
+		log.WithError(err).WithField("_id", _id).Debug("Can't get element rank")
+		return nil, err
 	}
-	return e, err
+	return index, err
 }
 
-// args: list string, _id string
-func listGetByIDHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
-	log.WithField("args", args).Debug("List GetByID arrived")
+// args: list, field string, unique bool (optional)
+func listCreateIndexHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("List CreateIndex arrived")
 	if len(args) < 2 {
 		return nil, errInvalidArguments
 	}
@@ -347,20 +623,26 @@ func listGetByIDHandler(c *wango.Conn, _uri string, args ...interface{}) (interf
 	if !ok {
 		return nil, errInvalidArguments
 	}
-	_id, ok := args[1].(string)
+	field, ok := args[1].(string)
 	if !ok {
 		return nil, errInvalidArguments
 	}
-	e, n, err := lists.GetByID(l, _id)
+	var unique bool
+	if len(args) > 2 && args[2] != nil {
+		if unique, ok = args[2].(bool); !ok {
+			return nil, errInvalidArguments
+		}
+	}
+	err := lists.CreateIndex(l, field, unique)
 	if err != nil {
-		log.WithError(err).WithField("_id", _id).Debug("Can't get element by _id")
+		log.WithError(err).WithField("field", field).Debug("Can't create index")
 	}
-	return m{"element": e, "position": n}, err
+	return nil, err
 }
 
-// args: list string, data interface{}
-func listUpdateByIDHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
-	log.WithField("args", args).Debug("List UpdateByID arrived")
+// args: list, field string
+func listDropIndexHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("List DropIndex arrived")
 	if len(args) < 2 {
 		return nil, errInvalidArguments
 	}
@@ -368,16 +650,20 @@ func listUpdateByIDHandler(c *wango.Conn, _uri string, args ...interface{}) (int
 	if !ok {
 		return nil, errInvalidArguments
 	}
-	err := lists.UpdateByID(l, args[1])
+	field, ok := args[1].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	err := lists.DropIndex(l, field)
 	if err != nil {
-		log.WithError(err).Debug("Can't update element by _id")
+		log.WithError(err).WithField("field", field).Debug("Can't drop index")
 	}
 	return nil, err
 }
 
 // args: list string
-func listLengthHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
-	log.WithField("args", args).Debug("List Length arrived")
+func listIndexesHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("List Indexes arrived")
 	if len(args) == 0 {
 		return nil, errInvalidArguments
 	}
@@ -385,29 +671,1186 @@ func listLengthHandler(c *wango.Conn, _uri string, args ...interface{}) (interfa
 	if !ok {
 		return nil, errInvalidArguments
 	}
-	length := lists.Len(l)
-	return length, nil
+	res, err := lists.Indexes(l)
+	if err != nil {
+		log.WithError(err).Debug("Can't get indexes")
+	}
+	return res, err
 }
 
-func internalOpenCallback(c *wango.Conn) {
-	log.Info("Connected client", c.ID())
+// args: list, field string, value interface{}
+func listFindByHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("List FindBy arrived")
+	if len(args) < 3 {
+		return nil, errInvalidArguments
+	}
+	l, ok := args[0].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	field, ok := args[1].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	res, err := lists.FindBy(l, field, args[2])
+	if err != nil {
+		log.WithError(err).WithField("field", field).Debug("Can't find elements")
+	}
+	return res, err
 }
 
-func internalCloseCallback(c *wango.Conn) {
-	log.Info("Disconnected client", c.ID())
+// args: list, field string, min, max interface{}, limit float64 (optional)
+func listFindRangeHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("List FindRange arrived")
+	if len(args) < 4 {
+		return nil, errInvalidArguments
+	}
+	l, ok := args[0].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	field, ok := args[1].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	var limit float64
+	if len(args) > 4 && args[4] != nil {
+		if limit, ok = args[4].(float64); !ok {
+			return nil, errInvalidArguments
+		}
+	}
+	res, err := lists.FindRange(l, field, args[2], args[3], int(limit))
+	if err != nil {
+		log.WithError(err).WithField("field", field).Debug("Can't find elements")
+	}
+	return res, err
 }
 
-func startServer() {
-	wampServer.SetSessionOpenCallback(internalOpenCallback)
-	wampServer.SetSessionCloseCallback(internalCloseCallback)
-
-	wampServer.RegisterRPCHandler("queue.push", queuePushHandler)
-	wampServer.RegisterRPCHandler("queue.shift", queueShiftHandler)
-	wampServer.RegisterRPCHandler("queue.unshift", queueUnshiftHandler)
-	wampServer.RegisterRPCHandler("queue.remove", queueRemoveHandler)
-	wampServer.RegisterRPCHandler("queue.length", queueLengthHandler)
-	wampServer.RegisterRPCHandler("queue.drop", queueDropHandler)
+// args: list string, maxLen float64, from string ("front" or "back")
+func listTrimHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("List Trim arrived")
+	if len(args) < 3 {
+		return nil, errInvalidArguments
+	}
+	l, ok := args[0].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	maxLen, ok := args[1].(float64)
+	if !ok || maxLen < 0 {
+		return nil, errInvalidArguments
+	}
+	from, ok := args[2].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	removed, err := lists.Trim(l, uint64(maxLen), from)
+	if err != nil {
+		log.WithError(err).Debug("Can't trim list")
+		return nil, err
+	}
+	return removed, nil
+}
+
+// args: list string, cap map[string]interface{}
+func listSetCapHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("List SetCap arrived")
+	if len(args) < 2 {
+		return nil, errInvalidArguments
+	}
+	l, ok := args[0].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	var listCap *lists.Cap
+	if args[1] != nil {
+		listCap = new(lists.Cap)
+		if err := decodeArg(args[1], listCap); err != nil {
+			return nil, err
+		}
+	}
+	removed, err := lists.SetCap(l, listCap)
+	if err != nil {
+		log.WithError(err).Debug("Can't set list cap")
+		return nil, err
+	}
+	return removed, nil
+}
+
+// args: list string, n float64
+func listNextHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("List Next arrived")
+	if len(args) < 2 {
+		return nil, errInvalidArguments
+	}
+	l, ok := args[0].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	_n, ok := args[1].(float64)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	e, n, err := lists.Next(l, int(_n))
+	if err != nil {
+		log.WithError(err).WithField("position", _n).Debug("Can't get next element")
+		return nil, err
+	}
+	return m{"element": e, "position": n}, err
+}
+
+// args: list string, n float64
+func listPrevHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("List Prev arrived")
+	if len(args) < 2 {
+		return nil, errInvalidArguments
+	}
+	l, ok := args[0].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	_n, ok := args[1].(float64)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	e, n, err := lists.Prev(l, int(_n))
+	if err != nil {
+		log.WithError(err).WithField("position", _n).Debug("Can't get prev element")
+		return nil, err
+	}
+	return m{"element": e, "position": n}, err
+}
+
+// args: list string, n float64, [soft bool]
+func listRemoveHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("List Remove arrived")
+	if len(args) < 2 {
+		return nil, errInvalidArguments
+	}
+	l, ok := args[0].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	_n, ok := args[1].(float64)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	var soft bool
+	if len(args) > 2 && args[2] != nil {
+		if soft, ok = args[2].(bool); !ok {
+			return nil, errInvalidArguments
+		}
+	}
+	var err error
+	if soft {
+		err = lists.SoftRemove(l, int(_n))
+	} else {
+		err = lists.Remove(l, int(_n))
+	}
+	if err != nil {
+		log.WithError(err).WithField("position", _n).Debug("Can't remove element")
+	}
+	return nil, err
+}
+
+// args: list string, _id string, [version float64], [soft bool]
+func listRemoveByIDHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("List RemoveByID arrived")
+	if len(args) < 2 {
+		return nil, errInvalidArguments
+	}
+	l, ok := args[0].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	_id, ok := args[1].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	var version float64
+	if len(args) > 2 && args[2] != nil {
+		if version, ok = args[2].(float64); !ok {
+			return nil, errInvalidArguments
+		}
+	}
+	var soft bool
+	if len(args) > 3 && args[3] != nil {
+		if soft, ok = args[3].(bool); !ok {
+			return nil, errInvalidArguments
+		}
+	}
+	var err error
+	if soft {
+		err = lists.SoftRemoveByID(l, _id, uint64(version))
+	} else {
+		err = lists.RemoveByIDIfVersion(l, _id, uint64(version))
+	}
+	if err != nil {
+		log.WithError(err).WithField("_id", _id).Debug("Can't remove element")
+	}
+	return nil, err
+}
+
+// args: list string
+func listDropHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("List Drop arrived")
+	if len(args) == 0 {
+		return nil, errInvalidArguments
+	}
+	l, ok := args[0].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	err := lists.Drop(l)
+	if err != nil {
+		log.WithError(err).Debug("Can't drop list")
+	}
+	return nil, err
+}
+
+// args: list string, n float64, [withVersion bool]
+func listGetHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("List Get arrived")
+	if len(args) < 2 {
+		return nil, errInvalidArguments
+	}
+	l, ok := args[0].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	_n, ok := args[1].(float64)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	if len(args) > 2 {
+		if withVersion, _ := args[2].(bool); withVersion {
+			e, v, err := lists.GetWithVersion(l, int(_n))
+			if err != nil {
+				log.WithError(err).WithField("position", _n).Debug("Can't get element")
+			}
+			return m{"element": e, "version": v}, err
+		}
+	}
+	e, err := lists.Get(l, int(_n))
+	if err != nil {
+		log.WithError(err).WithField("position", _n).Debug("Can't get element")
+	}
+	return e, err
+}
+
+// args: list string, _id string, [asOf float64] unix time in milliseconds
+func listGetByIDHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("List GetByID arrived")
+	if len(args) < 2 {
+		return nil, errInvalidArguments
+	}
+	l, ok := args[0].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	_id, ok := args[1].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	if len(args) > 2 && args[2] != nil {
+		asOf, ok := args[2].(float64)
+		if !ok {
+			return nil, errInvalidArguments
+		}
+		e, v, err := lists.GetByIDAsOf(l, _id, time.Unix(0, int64(asOf)*int64(time.Millisecond)))
+		if err != nil {
+			log.WithError(err).WithField("_id", _id).Debug("Can't get element by _id")
+		}
+		return m{"element": e, "version": v}, err
+	}
+	e, n, v, err := lists.GetByIDWithVersion(l, _id)
+	if err != nil {
+		log.WithError(err).WithField("_id", _id).Debug("Can't get element by _id")
+	}
+	return m{"element": e, "position": n, "version": v}, err
+}
+
+// args: list string, data interface{}, [version float64]
+func listUpdateByIDHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("List UpdateByID arrived")
+	if len(args) < 2 {
+		return nil, errInvalidArguments
+	}
+	l, ok := args[0].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	var version float64
+	if len(args) > 2 && args[2] != nil {
+		if version, ok = args[2].(float64); !ok {
+			return nil, errInvalidArguments
+		}
+	}
+	v, err := lists.UpdateByIDIfVersion(l, args[1], uint64(version))
+	if err != nil {
+		log.WithError(err).Debug("Can't update element by _id")
+		return nil, err
+	}
+	return m{"version": v}, nil
+}
+
+// args: list, _id string
+func listMoveToFrontHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("List MoveToFront arrived")
+	if len(args) < 2 {
+		return nil, errInvalidArguments
+	}
+	l, ok := args[0].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	_id, ok := args[1].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	n, err := lists.MoveToFront(l, _id)
+	if err != nil {
+		log.WithError(err).WithField("_id", _id).Debug("Can't move element")
+	}
+	return n, err
+}
+
+// args: list, _id string
+func listMoveToBackHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("List MoveToBack arrived")
+	if len(args) < 2 {
+		return nil, errInvalidArguments
+	}
+	l, ok := args[0].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	_id, ok := args[1].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	n, err := lists.MoveToBack(l, _id)
+	if err != nil {
+		log.WithError(err).WithField("_id", _id).Debug("Can't move element")
+	}
+	return n, err
+}
+
+// args: list, _id string, after float64
+func listMoveHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("List Move arrived")
+	if len(args) < 3 {
+		return nil, errInvalidArguments
+	}
+	l, ok := args[0].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	_id, ok := args[1].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	after, ok := args[2].(float64)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	n, err := lists.Move(l, _id, int(after))
+	if err != nil {
+		log.WithError(err).WithField("_id", _id).Debug("Can't move element")
+	}
+	return n, err
+}
+
+// args: list string
+func listPopFrontHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("List PopFront arrived")
+	if len(args) == 0 {
+		return nil, errInvalidArguments
+	}
+	l, ok := args[0].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	e, n, err := lists.PopFront(l)
+	if err != nil {
+		log.WithError(err).Debug("Can't pop element")
+		return nil, err
+	}
+	return m{"element": e, "position": n}, nil
+}
+
+// args: list string, timeout float64
+func listPopFrontWaitHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("List PopFrontWait arrived")
+	if len(args) < 2 {
+		return nil, errInvalidArguments
+	}
+	l, ok := args[0].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	timeout, ok := args[1].(float64)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	e, n, err := lists.PopFrontWait(l, time.Duration(timeout*float64(time.Millisecond)))
+	if err != nil {
+		log.WithError(err).Debug("Can't pop element")
+		return nil, err
+	}
+	return m{"element": e, "position": n}, nil
+}
+
+// args: list string
+func listPopBackHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("List PopBack arrived")
+	if len(args) == 0 {
+		return nil, errInvalidArguments
+	}
+	l, ok := args[0].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	e, n, err := lists.PopBack(l)
+	if err != nil {
+		log.WithError(err).Debug("Can't pop element")
+		return nil, err
+	}
+	return m{"element": e, "position": n}, nil
+}
+
+// args: list string, timeout float64
+func listPopBackWaitHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("List PopBackWait arrived")
+	if len(args) < 2 {
+		return nil, errInvalidArguments
+	}
+	l, ok := args[0].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	timeout, ok := args[1].(float64)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	e, n, err := lists.PopBackWait(l, time.Duration(timeout*float64(time.Millisecond)))
+	if err != nil {
+		log.WithError(err).Debug("Can't pop element")
+		return nil, err
+	}
+	return m{"element": e, "position": n}, nil
+}
+
+// args: list string, filter map[string]interface{}, sortBy string, fields []string, limit float64
+func listQueryHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("List Query arrived")
+	if len(args) == 0 {
+		return nil, errInvalidArguments
+	}
+	l, ok := args[0].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	var filter map[string]interface{}
+	if len(args) > 1 && args[1] != nil {
+		if filter, ok = args[1].(map[string]interface{}); !ok {
+			return nil, errInvalidArguments
+		}
+	}
+	var sortBy string
+	if len(args) > 2 && args[2] != nil {
+		if sortBy, ok = args[2].(string); !ok {
+			return nil, errInvalidArguments
+		}
+	}
+	var fields []string
+	if len(args) > 3 && args[3] != nil {
+		if err := decodeArg(args[3], &fields); err != nil {
+			return nil, errInvalidArguments
+		}
+	}
+	var limit float64
+	if len(args) > 4 && args[4] != nil {
+		if limit, ok = args[4].(float64); !ok {
+			return nil, errInvalidArguments
+		}
+	}
+	items, err := lists.Query(l, filter, sortBy, fields, int(limit))
+	if err != nil {
+		log.WithError(err).Debug("Can't query list")
+	}
+	return items, err
+}
+
+// args: list string, groupBy string, aggregations []map[string]interface{}, filter map[string]interface{}
+func listAggregateHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("List Aggregate arrived")
+	if len(args) < 3 {
+		return nil, errInvalidArguments
+	}
+	l, ok := args[0].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	var groupBy string
+	if args[1] != nil {
+		if groupBy, ok = args[1].(string); !ok {
+			return nil, errInvalidArguments
+		}
+	}
+	var aggs []*lists.Aggregation
+	if err := decodeArg(args[2], &aggs); err != nil {
+		return nil, errInvalidArguments
+	}
+	var filter map[string]interface{}
+	if len(args) > 3 && args[3] != nil {
+		if filter, ok = args[3].(map[string]interface{}); !ok {
+			return nil, errInvalidArguments
+		}
+	}
+	groups, err := lists.Aggregate(l, groupBy, aggs, filter)
+	if err != nil {
+		log.WithError(err).Debug("Can't aggregate list")
+	}
+	return groups, err
+}
+
+// args: lists []string, [dest string]
+func listUnionHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("List Union arrived")
+	return listSetOperation(lists.Union, args...)
+}
+
+// args: lists []string, [dest string]
+func listIntersectHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("List Intersect arrived")
+	return listSetOperation(lists.Intersect, args...)
+}
+
+// args: lists []string, [dest string]
+func listDiffHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("List Diff arrived")
+	return listSetOperation(lists.Diff, args...)
+}
+
+func listSetOperation(op func(names []string, dest string) ([]interface{}, error), args ...interface{}) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, errInvalidArguments
+	}
+	var names []string
+	if err := decodeArg(args[0], &names); err != nil {
+		return nil, errInvalidArguments
+	}
+	var dest string
+	if len(args) > 1 && args[1] != nil {
+		var ok bool
+		if dest, ok = args[1].(string); !ok {
+			return nil, errInvalidArguments
+		}
+	}
+	res, err := op(names, dest)
+	if err != nil {
+		log.WithError(err).Debug("Can't perform set operation on lists")
+		return nil, err
+	}
+	if dest != "" {
+		return len(res), nil
+	}
+	return res, nil
+}
+
+// args: list, _id string
+func listRestoreHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("List Restore arrived")
+	if len(args) < 2 {
+		return nil, errInvalidArguments
+	}
+	l, ok := args[0].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	_id, ok := args[1].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	n, err := lists.Restore(l, _id)
+	if err != nil {
+		log.WithError(err).WithField("_id", _id).Debug("Can't restore element")
+	}
+	return n, err
+}
+
+// args: list string
+func listTrashHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("List Trash arrived")
+	if len(args) == 0 {
+		return nil, errInvalidArguments
+	}
+	l, ok := args[0].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	items, err := lists.Trash(l)
+	if err != nil {
+		log.WithError(err).Debug("Can't get list trash")
+	}
+	return items, err
+}
+
+// args: list, _id string
+func listHistoryHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("List History arrived")
+	if len(args) < 2 {
+		return nil, errInvalidArguments
+	}
+	l, ok := args[0].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	_id, ok := args[1].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	revisions, err := lists.History(l, _id)
+	if err != nil {
+		log.WithError(err).WithField("_id", _id).Debug("Can't get element history")
+	}
+	return revisions, err
+}
+
+// args: list string, depth float64
+func listSetHistoryHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("List SetHistory arrived")
+	if len(args) < 2 {
+		return nil, errInvalidArguments
+	}
+	l, ok := args[0].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	depth, ok := args[1].(float64)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	err := lists.SetHistory(l, int(depth))
+	if err != nil {
+		log.WithError(err).Debug("Can't set list history depth")
+	}
+	return nil, err
+}
+
+// args: list string, retention float64 (ms)
+func listSetTrashRetentionHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("List SetTrashRetention arrived")
+	if len(args) < 2 {
+		return nil, errInvalidArguments
+	}
+	l, ok := args[0].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	retention, ok := args[1].(float64)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	err := lists.SetTrashRetention(l, time.Duration(retention*float64(time.Millisecond)))
+	if err != nil {
+		log.WithError(err).Debug("Can't set list trash retention")
+	}
+	return nil, err
+}
+
+// args: list string, n float64, [weightField string]
+func listRandomHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("List Random arrived")
+	if len(args) < 2 {
+		return nil, errInvalidArguments
+	}
+	l, ok := args[0].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	n, ok := args[1].(float64)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	var weightField string
+	if len(args) > 2 && args[2] != nil {
+		if weightField, ok = args[2].(string); !ok {
+			return nil, errInvalidArguments
+		}
+	}
+	var items []*lists.Item
+	var err error
+	if weightField != "" {
+		items, err = lists.RandomWeighted(l, int(n), weightField)
+	} else {
+		items, err = lists.Random(l, int(n))
+	}
+	if err != nil {
+		log.WithError(err).Debug("Can't get random elements")
+	}
+	return items, err
+}
+
+// args: list string, weightField string
+func listSetWeightFieldHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("List SetWeightField arrived")
+	if len(args) < 2 {
+		return nil, errInvalidArguments
+	}
+	l, ok := args[0].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	weightField, ok := args[1].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	err := lists.SetWeightField(l, weightField)
+	if err != nil {
+		log.WithError(err).Debug("Can't set list weight field")
+	}
+	return nil, err
+}
+
+// args: list string, partitioning map[string]interface{}
+func listCreatePartitionedHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("List CreatePartitioned arrived")
+	if len(args) < 2 {
+		return nil, errInvalidArguments
+	}
+	l, ok := args[0].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	var p lists.Partitioning
+	if err := decodeArg(args[1], &p); err != nil {
+		return nil, errInvalidArguments
+	}
+	err := lists.CreatePartitioned(l, &p)
+	if err != nil {
+		log.WithError(err).Debug("Can't create partitioned list")
+	}
+	return nil, err
+}
+
+// args: list string
+func listPartitionsHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("List Partitions arrived")
+	if len(args) == 0 {
+		return nil, errInvalidArguments
+	}
+	l, ok := args[0].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	partitions, err := lists.Partitions(l)
+	if err != nil {
+		log.WithError(err).Debug("Can't get list partitions")
+	}
+	return partitions, err
+}
+
+// args: list string
+func listCompactHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("List Compact arrived")
+	if len(args) == 0 {
+		return nil, errInvalidArguments
+	}
+	l, ok := args[0].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	mapping, err := lists.Compact(l)
+	if err != nil {
+		log.WithError(err).Debug("Can't compact list")
+		return nil, err
+	}
+	return mapping, nil
+}
+
+// args: list string, data interface{}
+func listUpsertByIDHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("List UpsertByID arrived")
+	if len(args) < 2 {
+		return nil, errInvalidArguments
+	}
+	l, ok := args[0].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	n, inserted, err := lists.UpsertByID(l, args[1])
+	if err != nil {
+		log.WithError(err).Debug("Can't upsert element by _id")
+		return nil, err
+	}
+	return m{"position": n, "inserted": inserted}, nil
+}
+
+// args: list string, elements []interface{}
+func listReplaceAllHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("List ReplaceAll arrived")
+	if len(args) < 2 {
+		return nil, errInvalidArguments
+	}
+	l, ok := args[0].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	elements, ok := args[1].([]interface{})
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	err := lists.ReplaceAll(l, elements)
+	if err != nil {
+		log.WithError(err).Debug("Can't replace list elements")
+	}
+	return nil, err
+}
+
+// args: list, _id string, patch interface{}
+func listPatchByIDHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("List PatchByID arrived")
+	if len(args) < 3 {
+		return nil, errInvalidArguments
+	}
+	l, ok := args[0].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	_id, ok := args[1].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	e, err := lists.PatchByID(l, _id, args[2])
+	if err != nil {
+		log.WithError(err).WithField("_id", _id).Debug("Can't patch element by _id")
+	}
+	return e, err
+}
+
+// args: list, _id string, ops []map[string]interface{}
+func listModifyByIDHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("List ModifyByID arrived")
+	if len(args) < 3 {
+		return nil, errInvalidArguments
+	}
+	l, ok := args[0].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	_id, ok := args[1].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	var ops []*lists.FieldOp
+	if err := decodeArg(args[2], &ops); err != nil {
+		return nil, err
+	}
+	e, err := lists.ModifyByID(l, _id, ops)
+	if err != nil {
+		log.WithError(err).WithField("_id", _id).Debug("Can't modify element by _id")
+	}
+	return e, err
+}
+
+// args: list string
+func listLengthHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("List Length arrived")
+	if len(args) == 0 {
+		return nil, errInvalidArguments
+	}
+	l, ok := args[0].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	length := lists.Len(l)
+	return length, nil
+}
+
+// decodeArg converts WAMP call argument to the passed value through JSON
+func decodeArg(arg interface{}, v interface{}) error {
+	encoded, err := json.Marshal(arg)
+	if err != nil {
+		return errInvalidArguments
+	}
+	if err = json.Unmarshal(encoded, v); err != nil {
+		return errInvalidArguments
+	}
+	return nil
+}
+
+// args: set string, score float64, element interface{}
+func zsetAddHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("ZSet Add arrived")
+	if len(args) < 3 {
+		return nil, errInvalidArguments
+	}
+	s, ok := args[0].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	score, ok := args[1].(float64)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	added, err := zsets.Add(s, score, args[2])
+	if err != nil {
+		log.WithError(err).Debug("Can't add member")
+	}
+	return added, err
+}
+
+// args: set, _id string, delta float64
+func zsetIncrByHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("ZSet IncrBy arrived")
+	if len(args) < 3 {
+		return nil, errInvalidArguments
+	}
+	s, ok := args[0].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	_id, ok := args[1].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	delta, ok := args[2].(float64)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	score, err := zsets.IncrBy(s, _id, delta)
+	if err != nil {
+		log.WithError(err).WithField("_id", _id).Debug("Can't increment score")
+		return nil, err
+	}
+	return score, nil
+}
+
+// args: set, _id string
+func zsetScoreHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("ZSet Score arrived")
+	if len(args) < 2 {
+		return nil, errInvalidArguments
+	}
+	s, ok := args[0].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	_id, ok := args[1].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	score, err := zsets.Score(s, _id)
+	if err != nil {
+		log.WithError(err).WithField("_id", _id).Debug("Can't get score")
+		return nil, err
+	}
+	return score, nil
+}
+
+// args: set, _id string
+func zsetRankHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("ZSet Rank arrived")
+	if len(args) < 2 {
+		return nil, errInvalidArguments
+	}
+	s, ok := args[0].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	_id, ok := args[1].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	rank, err := zsets.Rank(s, _id)
+	if err != nil {
+		log.WithError(err).WithField("_id", _id).Debug("Can't get rank")
+		return nil, err
+	}
+	return rank, nil
+}
+
+// args: set string, min, max float64, limit float64 (optional), direction string ("forward" or "backward", optional)
+func zsetRangeByScoreHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("ZSet RangeByScore arrived")
+	if len(args) < 3 {
+		return nil, errInvalidArguments
+	}
+	s, ok := args[0].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	min, ok := args[1].(float64)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	max, ok := args[2].(float64)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	var limit float64
+	if len(args) > 3 && args[3] != nil {
+		if limit, ok = args[3].(float64); !ok {
+			return nil, errInvalidArguments
+		}
+	}
+	var reverse bool
+	if len(args) > 4 && args[4] != nil {
+		switch args[4] {
+		case "forward":
+		case "backward":
+			reverse = true
+		default:
+			return nil, errInvalidArguments
+		}
+	}
+	res, err := zsets.RangeByScore(s, min, max, int(limit), reverse)
+	if err != nil {
+		log.WithError(err).Debug("Can't get range by score")
+	}
+	return res, err
+}
+
+// args: set string, start, stop float64
+func zsetRangeByRankHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("ZSet RangeByRank arrived")
+	if len(args) < 3 {
+		return nil, errInvalidArguments
+	}
+	s, ok := args[0].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	start, ok := args[1].(float64)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	stop, ok := args[2].(float64)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	res, err := zsets.RangeByRank(s, int(start), int(stop))
+	if err != nil {
+		log.WithError(err).Debug("Can't get range by rank")
+	}
+	return res, err
+}
+
+// args: set, _id string
+func zsetRemoveHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("ZSet Remove arrived")
+	if len(args) < 2 {
+		return nil, errInvalidArguments
+	}
+	s, ok := args[0].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	_id, ok := args[1].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	err := zsets.Remove(s, _id)
+	if err != nil {
+		log.WithError(err).WithField("_id", _id).Debug("Can't remove member")
+	}
+	return nil, err
+}
+
+// args: set string, min, max float64
+func zsetRemoveByScoreHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("ZSet RemoveByScore arrived")
+	if len(args) < 3 {
+		return nil, errInvalidArguments
+	}
+	s, ok := args[0].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	min, ok := args[1].(float64)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	max, ok := args[2].(float64)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	n, err := zsets.RemoveByScore(s, min, max)
+	if err != nil {
+		log.WithError(err).Debug("Can't remove members by score")
+		return nil, err
+	}
+	return n, nil
+}
+
+// args: set string
+func zsetLengthHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("ZSet Length arrived")
+	if len(args) == 0 {
+		return nil, errInvalidArguments
+	}
+	s, ok := args[0].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	return zsets.Len(s), nil
+}
+
+// args: set string
+func zsetDropHandler(c *wango.Conn, _uri string, args ...interface{}) (interface{}, error) {
+	log.WithField("args", args).Debug("ZSet Drop arrived")
+	if len(args) == 0 {
+		return nil, errInvalidArguments
+	}
+	s, ok := args[0].(string)
+	if !ok {
+		return nil, errInvalidArguments
+	}
+	err := zsets.Drop(s)
+	if err != nil {
+		log.WithError(err).Debug("Can't drop sorted set")
+	}
+	return nil, err
+}
+
+func internalOpenCallback(c *wango.Conn) {
+	log.Info("Connected client", c.ID())
+}
+
+func internalCloseCallback(c *wango.Conn) {
+	log.Info("Disconnected client", c.ID())
+}
+
+func startServer() {
+	wampServer.SetSessionOpenCallback(internalOpenCallback)
+	wampServer.SetSessionCloseCallback(internalCloseCallback)
+	wampServer.RegisterSubHandler(listRemappedURI, nil, nil, nil)
+	lists.OnRemap(func(list string, mapping map[int]int) {
+		wampServer.Publish(listRemappedURI, m{"list": list, "mapping": mapping})
+	})
+
+	wampServer.RegisterRPCHandler("queue.push", queuePushHandler)
+	wampServer.RegisterRPCHandler("queue.shift", queueShiftHandler)
+	wampServer.RegisterRPCHandler("queue.shiftBatch", queueShiftBatchHandler)
+	wampServer.RegisterRPCHandler("queue.unshift", queueUnshiftHandler)
+	wampServer.RegisterRPCHandler("queue.remove", queueRemoveHandler)
+	wampServer.RegisterRPCHandler("queue.length", queueLengthHandler)
+	wampServer.RegisterRPCHandler("queue.drop", queueDropHandler)
 	wampServer.RegisterRPCHandler("queue.get", queueGetHandler)
+	wampServer.RegisterRPCHandler("queue.nack", queueNackHandler)
+	wampServer.RegisterRPCHandler("queue.setRetryPolicy", queueSetRetryPolicyHandler)
+	wampServer.RegisterRPCHandler("queue.setCoalescing", queueSetCoalescingHandler)
+
+	wampServer.RegisterRPCHandler("exchange.bind", exchangeBindHandler)
+	wampServer.RegisterRPCHandler("exchange.unbind", exchangeUnbindHandler)
+	wampServer.RegisterRPCHandler("exchange.bindings", exchangeBindingsHandler)
+	wampServer.RegisterRPCHandler("exchange.push", exchangePushHandler)
+
+	wampServer.RegisterRPCHandler("pipeline.create", pipelineCreateHandler)
+	wampServer.RegisterRPCHandler("pipeline.remove", pipelineRemoveHandler)
+	wampServer.RegisterRPCHandler("pipeline.list", pipelineListHandler)
 
 	wampServer.RegisterRPCHandler("list.front", listFrontHandler)
 	wampServer.RegisterRPCHandler("list.back", listBackHandler)
@@ -421,7 +1864,57 @@ func startServer() {
 	wampServer.RegisterRPCHandler("list.get", listGetHandler)
 	wampServer.RegisterRPCHandler("list.getById", listGetByIDHandler)
 	wampServer.RegisterRPCHandler("list.updateById", listUpdateByIDHandler)
+	wampServer.RegisterRPCHandler("list.upsertById", listUpsertByIDHandler)
+	wampServer.RegisterRPCHandler("list.compact", listCompactHandler)
+	wampServer.RegisterRPCHandler("list.createPartitioned", listCreatePartitionedHandler)
+	wampServer.RegisterRPCHandler("list.partitions", listPartitionsHandler)
+	wampServer.RegisterRPCHandler("list.query", listQueryHandler)
+	wampServer.RegisterRPCHandler("list.random", listRandomHandler)
+	wampServer.RegisterRPCHandler("list.setWeightField", listSetWeightFieldHandler)
+	wampServer.RegisterRPCHandler("list.aggregate", listAggregateHandler)
+	wampServer.RegisterRPCHandler("list.history", listHistoryHandler)
+	wampServer.RegisterRPCHandler("list.setHistory", listSetHistoryHandler)
+	wampServer.RegisterRPCHandler("list.restore", listRestoreHandler)
+	wampServer.RegisterRPCHandler("list.trash", listTrashHandler)
+	wampServer.RegisterRPCHandler("list.setTrashRetention", listSetTrashRetentionHandler)
+	wampServer.RegisterRPCHandler("list.union", listUnionHandler)
+	wampServer.RegisterRPCHandler("list.intersect", listIntersectHandler)
+	wampServer.RegisterRPCHandler("list.diff", listDiffHandler)
+	wampServer.RegisterRPCHandler("list.popFront", listPopFrontHandler)
+	wampServer.RegisterRPCHandler("list.popBack", listPopBackHandler)
+	wampServer.RegisterRPCHandler("list.popFrontWait", listPopFrontWaitHandler)
+	wampServer.RegisterRPCHandler("list.popBackWait", listPopBackWaitHandler)
+	wampServer.RegisterRPCHandler("list.moveToFront", listMoveToFrontHandler)
+	wampServer.RegisterRPCHandler("list.moveToBack", listMoveToBackHandler)
+	wampServer.RegisterRPCHandler("list.move", listMoveHandler)
+	wampServer.RegisterRPCHandler("list.replaceAll", listReplaceAllHandler)
+	wampServer.RegisterRPCHandler("list.patchById", listPatchByIDHandler)
+	wampServer.RegisterRPCHandler("list.modifyById", listModifyByIDHandler)
 	wampServer.RegisterRPCHandler("list.length", listLengthHandler)
+	wampServer.RegisterRPCHandler("list.insertBefore", listInsertBeforeHandler)
+	wampServer.RegisterRPCHandler("list.insertAfter", listInsertAfterHandler)
+	wampServer.RegisterRPCHandler("list.range", listRangeHandler)
+	wampServer.RegisterRPCHandler("list.slice", listSliceHandler)
+	wampServer.RegisterRPCHandler("list.at", listAtHandler)
+	wampServer.RegisterRPCHandler("list.rank", listRankHandler)
+	wampServer.RegisterRPCHandler("list.createIndex", listCreateIndexHandler)
+	wampServer.RegisterRPCHandler("list.dropIndex", listDropIndexHandler)
+	wampServer.RegisterRPCHandler("list.indexes", listIndexesHandler)
+	wampServer.RegisterRPCHandler("list.findBy", listFindByHandler)
+	wampServer.RegisterRPCHandler("list.findRange", listFindRangeHandler)
+	wampServer.RegisterRPCHandler("list.trim", listTrimHandler)
+	wampServer.RegisterRPCHandler("list.setCap", listSetCapHandler)
+
+	wampServer.RegisterRPCHandler("zset.add", zsetAddHandler)
+	wampServer.RegisterRPCHandler("zset.incrBy", zsetIncrByHandler)
+	wampServer.RegisterRPCHandler("zset.score", zsetScoreHandler)
+	wampServer.RegisterRPCHandler("zset.rank", zsetRankHandler)
+	wampServer.RegisterRPCHandler("zset.rangeByScore", zsetRangeByScoreHandler)
+	wampServer.RegisterRPCHandler("zset.rangeByRank", zsetRangeByRankHandler)
+	wampServer.RegisterRPCHandler("zset.remove", zsetRemoveHandler)
+	wampServer.RegisterRPCHandler("zset.removeByScore", zsetRemoveByScoreHandler)
+	wampServer.RegisterRPCHandler("zset.length", zsetLengthHandler)
+	wampServer.RegisterRPCHandler("zset.drop", zsetDropHandler)
 
 	s := new(websocket.Server)
 	s.Handshake = func(c *websocket.Config, r *http.Request) error {
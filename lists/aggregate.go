@@ -0,0 +1,199 @@
+package lists
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/getblank/blank-queue/common"
+)
+
+// Aggregation operations
+const (
+	AggCount = "count"
+	AggSum   = "sum"
+	AggMin   = "min"
+	AggMax   = "max"
+	AggAvg   = "avg"
+)
+
+var errInvalidAggregation = errors.New("invalid aggregation")
+
+// Aggregation describes value to calculate for every group. Field is a dot separated path to the property,
+// it is not required for count. As is the name of the result value, op and field joined by "_" are used if it is empty.
+type Aggregation struct {
+	Op    string `json:"op"`
+	Field string `json:"field"`
+	As    string `json:"as"`
+}
+
+// Group is the aggregation result for elements with the same groupBy property value
+type Group struct {
+	Key    interface{}            `json:"key"`
+	Values map[string]interface{} `json:"values"`
+}
+
+type accumulator struct {
+	count int
+	sum   float64
+	min   interface{}
+	max   interface{}
+}
+
+// Aggregate groups elements matching the filter by the groupBy property and calculates aggregations for every group.
+// If groupBy is empty, all elements are aggregated into one group with nil key. Groups are ordered by the key.
+// Sum and avg take only numeric values into account, min and max compare numbers or strings.
+func Aggregate(list string, groupBy string, aggs []*Aggregation, filter map[string]interface{}) (groups []*Group, err error) {
+	for _, a := range aggs {
+		if err = a.validate(); err != nil {
+			return nil, err
+		}
+	}
+	err = common.ValidateFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	keys := map[string]interface{}{}
+	accs := map[string][]*accumulator{}
+	err = db.View(func(tx *bolt.Tx) error {
+		elB, err := elementsBucket(tx, list)
+		if err != nil {
+			return err
+		}
+		return elB.ForEach(func(_, v []byte) error {
+			var data interface{}
+			err := json.Unmarshal(v, &data)
+			if err != nil {
+				return err
+			}
+			ok, err := common.Match(data, filter)
+			if err != nil || !ok {
+				return err
+			}
+			var key interface{}
+			if groupBy != "" {
+				key, _ = common.GetField(data, groupBy)
+			}
+			encoded, err := json.Marshal(key)
+			if err != nil {
+				return err
+			}
+			groupAccs, ok := accs[string(encoded)]
+			if !ok {
+				keys[string(encoded)] = key
+				groupAccs = make([]*accumulator, len(aggs))
+				for i := range groupAccs {
+					groupAccs[i] = &accumulator{}
+				}
+				accs[string(encoded)] = groupAccs
+			}
+			for i, a := range aggs {
+				groupAccs[i].add(a, data)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	groups = make([]*Group, 0, len(accs))
+	for encoded, groupAccs := range accs {
+		g := &Group{Key: keys[encoded], Values: map[string]interface{}{}}
+		for i, a := range aggs {
+			g.Values[a.name()] = groupAccs[i].result(a.Op)
+		}
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		a, b := groups[i].Key, groups[j].Key
+		if sortRank(a) != sortRank(b) {
+			return sortRank(a) < sortRank(b)
+		}
+		if res, ok := common.Compare(a, b); ok {
+			return res < 0
+		}
+		x, _ := json.Marshal(a)
+		y, _ := json.Marshal(b)
+		return string(x) < string(y)
+	})
+	return groups, nil
+}
+
+func (a *Aggregation) name() string {
+	if a.As != "" {
+		return a.As
+	}
+	if a.Field == "" {
+		return a.Op
+	}
+	return a.Op + "_" + a.Field
+}
+
+func (a *Aggregation) validate() error {
+	if a == nil {
+		return errInvalidAggregation
+	}
+	switch a.Op {
+	case AggCount:
+		return nil
+	case AggSum, AggMin, AggMax, AggAvg:
+		if a.Field == "" {
+			return errInvalidAggregation
+		}
+		return nil
+	}
+	return errInvalidAggregation
+}
+
+func (acc *accumulator) add(a *Aggregation, data interface{}) {
+	if a.Op == AggCount && a.Field == "" {
+		acc.count++
+		return
+	}
+	v, ok := common.GetField(data, a.Field)
+	if !ok || v == nil {
+		return
+	}
+	switch a.Op {
+	case AggCount:
+		acc.count++
+	case AggSum, AggAvg:
+		if n, ok := common.ToFloat(v); ok {
+			acc.sum += n
+			acc.count++
+		}
+	case AggMin:
+		if acc.min == nil && sortRank(v) < 2 {
+			acc.min = v
+		} else if res, ok := common.Compare(v, acc.min); ok && res < 0 {
+			acc.min = v
+		}
+	case AggMax:
+		if acc.max == nil && sortRank(v) < 2 {
+			acc.max = v
+		} else if res, ok := common.Compare(v, acc.max); ok && res > 0 {
+			acc.max = v
+		}
+	}
+}
+
+func (acc *accumulator) result(op string) interface{} {
+	switch op {
+	case AggCount:
+		return acc.count
+	case AggSum:
+		return acc.sum
+	case AggMin:
+		return acc.min
+	case AggMax:
+		return acc.max
+	case AggAvg:
+		if acc.count == 0 {
+			return nil
+		}
+		return acc.sum / float64(acc.count)
+	}
+	return nil
+}
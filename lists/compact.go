@@ -0,0 +1,226 @@
+package lists
+
+import (
+	"math"
+	"time"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/getblank/blank-queue/common"
+)
+
+const (
+	// compactBatchSize is the max number of elements visited by one compaction transaction
+	compactBatchSize = 1000
+	// compactRounds is the max number of compaction rounds made while the list is changed by other writers
+	compactRounds = 3
+)
+
+// Compact renumbers elements of the list densely starting from the sequence number 1 and keeps their order.
+// It moves PushBack and PushFront sequences back to the middle of the sequence space.
+// Returns mapping of the changed sequence numbers from old to new ones.
+// Original positions of the trashed elements are not valid after compaction, so they are restored to the back of the list.
+// Elements are renumbered by the separate transactions of up to compactBatchSize elements, so writes can interleave with
+// the compaction. Mapping of every transaction is passed to the OnRemap handler when it is committed.
+// Compaction is repeated if the list was changed during the previous round, up to compactRounds times,
+// so elements added or removed by the frequent writes can leave gaps in the renumbered sequences.
+func Compact(list string) (mapping map[int]int, err error) {
+	mapping = map[int]int{}
+	// origins keeps original sequences of the moved elements by their current sequences
+	origins := map[uint64]uint64{}
+	for round := 0; round < compactRounds; round++ {
+		err = compactRound(list, origins, mapping)
+		if err != nil {
+			return nil, err
+		}
+		dense, err := isDense(list)
+		if err != nil {
+			return nil, err
+		}
+		if dense {
+			break
+		}
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, elB, err := listBuckets(tx, list)
+		if err != nil {
+			return err
+		}
+		stats, err := getStat(list, b)
+		if err != nil {
+			return err
+		}
+		// elements added during the compaction could be left out of the renumbered range
+		stats.PrevSequence = common.ZeroPoint
+		last := common.ZeroPoint
+		c := elB.Cursor()
+		if k, _ := c.First(); k != nil && common.BytesToSeq(k) <= common.ZeroPoint {
+			stats.PrevSequence = common.BytesToSeq(k) - 1
+		}
+		if k, _ := c.Last(); k != nil && common.BytesToSeq(k) > last {
+			last = common.BytesToSeq(k)
+		}
+		err = elB.SetSequence(last - common.ZeroPoint)
+		if err != nil {
+			return err
+		}
+		stats.CompactedAt = time.Now()
+		return saveStat(stats, b)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return mapping, nil
+}
+
+// compactRound moves elements towards the front by the forward batches and then towards the back by the backward batches.
+// Moved elements are added to the mapping from their original sequences, origins keeps them by the current sequences.
+func compactRound(list string, origins map[uint64]uint64, mapping map[int]int) (err error) {
+	for _, forward := range []bool{true, false} {
+		// zero sequence starts from the edge of the list
+		var from uint64
+		for more := true; more; {
+			var moves map[uint64]uint64
+			moves, from, more, err = compactBatch(list, from, forward)
+			if err != nil {
+				return err
+			}
+			remapped := make(map[int]int, len(moves))
+			moved := make(map[uint64]uint64, len(moves))
+			for s, to := range moves {
+				remapped[int(s-common.ZeroPoint)] = int(to - common.ZeroPoint)
+				orig, ok := origins[s]
+				if !ok {
+					orig = s
+				}
+				moved[to] = orig
+			}
+			for s := range moves {
+				delete(origins, s)
+			}
+			for to, orig := range moved {
+				origins[to] = orig
+				if to == orig {
+					delete(mapping, int(orig-common.ZeroPoint))
+					continue
+				}
+				mapping[int(orig-common.ZeroPoint)] = int(to - common.ZeroPoint)
+			}
+			notifyRemap(list, remapped)
+		}
+	}
+	return nil
+}
+
+// isDense reports whether elements of the list take sequences from 1 to the list length without gaps
+func isDense(list string) (dense bool, err error) {
+	err = db.View(func(tx *bolt.Tx) error {
+		b, elB, err := listBuckets(tx, list)
+		if err != nil {
+			return err
+		}
+		c := elB.Cursor()
+		first, _ := c.First()
+		last, _ := c.Last()
+		dense = first == nil || common.BytesToSeq(first) == common.ZeroPoint+1 &&
+			common.BytesToSeq(last) == common.ZeroPoint+totalCount(b, elB)
+		return nil
+	})
+	return dense, err
+}
+
+// compactBatch moves up to compactBatchSize elements to their dense sequences in one transaction.
+// Forward batch visits elements from the passed sequence to the back and moves them towards the front,
+// backward batch visits elements from the passed sequence to the front and moves them towards the back.
+// Element is moved only if there are no other elements between it and the target sequence, so the order is kept
+// even if the list was changed by other transactions between batches.
+// Zero sequence starts the batch from the edge of the list.
+// Returns moved elements from old to new sequences, sequence to continue from and false if all elements were visited.
+func compactBatch(list string, from uint64, forward bool) (moves map[uint64]uint64, next uint64, more bool, err error) {
+	err = db.Update(func(tx *bolt.Tx) error {
+		moves = map[uint64]uint64{}
+		b, elB, err := listBuckets(tx, list)
+		if err != nil {
+			return err
+		}
+		var seqs []uint64
+		// neighbour is the sequence of the element before the first visited one for the forward batch
+		// and after it for the backward batch
+		var neighbour uint64
+		c := elB.Cursor()
+		var k []byte
+		if forward {
+			if from == 0 {
+				k, _ = c.First()
+			} else {
+				k, _ = c.Seek(common.SeqToBytes(from))
+				if prev, _ := c.Prev(); prev != nil {
+					neighbour = common.BytesToSeq(prev)
+				}
+				k, _ = c.Seek(common.SeqToBytes(from))
+			}
+		} else {
+			neighbour = math.MaxUint64
+			if from == 0 {
+				k, _ = c.Last()
+			} else if k, _ = c.Seek(common.SeqToBytes(from + 1)); k != nil {
+				neighbour = common.BytesToSeq(k)
+				k, _ = c.Prev()
+			} else {
+				k, _ = c.Last()
+			}
+		}
+		for ; k != nil && len(seqs) < compactBatchSize; k, _ = step(c, !forward) {
+			seqs = append(seqs, common.BytesToSeq(k))
+		}
+		more = k != nil
+		if len(seqs) == 0 {
+			return nil
+		}
+		index := rank(b, elB, seqs[0])
+		for i, seq := range seqs {
+			var target uint64
+			if forward {
+				target = common.ZeroPoint + 1 + index + uint64(i)
+			} else {
+				target = common.ZeroPoint + 1 + index - uint64(i)
+			}
+			if forward && seq > target && neighbour < target || !forward && seq < target && neighbour > target {
+				err = moveElement(list, b, elB, common.SeqToBytes(seq), common.SeqToBytes(target))
+				if err != nil {
+					return err
+				}
+				moves[seq] = target
+				neighbour = target
+			} else {
+				neighbour = seq
+			}
+		}
+		last := seqs[len(seqs)-1]
+		if forward {
+			next = last + 1
+		} else {
+			next = last - 1
+		}
+		if len(moves) == 0 {
+			return nil
+		}
+		// elements moved towards the back must not be overwritten by the pushes between batches
+		if to, ok := moves[seqs[0]]; ok && !forward && elB.Sequence() < to-common.ZeroPoint {
+			err = elB.SetSequence(to - common.ZeroPoint)
+			if err != nil {
+				return err
+			}
+		}
+		stats, err := getStat(list, b)
+		if err != nil {
+			return err
+		}
+		stats.CompactedAt = time.Now()
+		return saveStat(stats, b)
+	})
+	if err != nil {
+		return nil, 0, false, err
+	}
+	return moves, next, more, nil
+}
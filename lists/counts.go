@@ -0,0 +1,131 @@
+package lists
+
+import (
+	"encoding/binary"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/getblank/blank-queue/common"
+)
+
+// countsBlockBits defines size of the sequences block with maintained elements counter
+const countsBlockBits = 10
+
+var countsBucket = []byte("_counts")
+
+// getCountsBucket returns bucket with the number of elements for each block of sequences.
+// It creates and fills bucket for the lists created before counters were introduced.
+func getCountsBucket(b, elB *bolt.Bucket) (*bolt.Bucket, error) {
+	if cb := b.Bucket(countsBucket); cb != nil {
+		return cb, nil
+	}
+	cb, err := b.CreateBucket(countsBucket)
+	if err != nil {
+		return nil, err
+	}
+	counts := map[uint64]uint64{}
+	err = elB.ForEach(func(k, _ []byte) error {
+		counts[block(common.BytesToSeq(k))]++
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for bl, n := range counts {
+		err = cb.Put(uint64ToBytes(bl), uint64ToBytes(n))
+		if err != nil {
+			return nil, err
+		}
+	}
+	return cb, nil
+}
+
+// addCount adds delta to the counter of the block with passed sequence
+func addCount(b, elB *bolt.Bucket, seq uint64, delta int) error {
+	cb, err := getCountsBucket(b, elB)
+	if err != nil {
+		return err
+	}
+	key := uint64ToBytes(block(seq))
+	var n uint64
+	if v := cb.Get(key); v != nil {
+		n = binary.BigEndian.Uint64(v)
+	}
+	n = uint64(int64(n) + int64(delta))
+	if n == 0 {
+		return cb.Delete(key)
+	}
+	return cb.Put(key, uint64ToBytes(n))
+}
+
+// seekIndex returns key and value of the element by it's ordinal index from the front of the list
+func seekIndex(b, elB *bolt.Bucket, index uint64) (k, v []byte) {
+	c := elB.Cursor()
+	cb := b.Bucket(countsBucket)
+	if cb == nil {
+		k, v = c.First()
+		for i := uint64(0); i < index && k != nil; i++ {
+			k, v = c.Next()
+		}
+		return k, v
+	}
+	var skipped uint64
+	cc := cb.Cursor()
+	for bk, bv := cc.First(); bk != nil; bk, bv = cc.Next() {
+		n := binary.BigEndian.Uint64(bv)
+		if skipped+n <= index {
+			skipped += n
+			continue
+		}
+		start := binary.BigEndian.Uint64(bk) << countsBlockBits
+		k, v = c.Seek(common.SeqToBytes(start))
+		for ; skipped < index && k != nil; skipped++ {
+			k, v = c.Next()
+		}
+		return k, v
+	}
+	return nil, nil
+}
+
+// rank returns ordinal index of the element with passed sequence from the front of the list
+func rank(b, elB *bolt.Bucket, seq uint64) uint64 {
+	var index uint64
+	c := elB.Cursor()
+	k, _ := c.First()
+	if cb := b.Bucket(countsBucket); cb != nil {
+		target := block(seq)
+		cc := cb.Cursor()
+		for bk, bv := cc.First(); bk != nil && binary.BigEndian.Uint64(bk) < target; bk, bv = cc.Next() {
+			index += binary.BigEndian.Uint64(bv)
+		}
+		k, _ = c.Seek(common.SeqToBytes(target << countsBlockBits))
+	}
+	for ; k != nil && common.BytesToSeq(k) < seq; k, _ = c.Next() {
+		index++
+	}
+	return index
+}
+
+// totalCount returns number of elements in the list
+func totalCount(b, elB *bolt.Bucket) uint64 {
+	cb := b.Bucket(countsBucket)
+	if cb == nil {
+		return uint64(elB.Stats().KeyN)
+	}
+	var total uint64
+	cb.ForEach(func(_, v []byte) error {
+		total += binary.BigEndian.Uint64(v)
+		return nil
+	})
+	return total
+}
+
+func block(seq uint64) uint64 {
+	return seq >> countsBlockBits
+}
+
+func uint64ToBytes(n uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, n)
+	return b
+}
@@ -0,0 +1,179 @@
+package lists
+
+import (
+	"encoding/json"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/getblank/blank-queue/common"
+)
+
+// putElement stores element by the sequence, assigns new version to it, creates _id index records for it
+// and saves it to the element history
+func putElement(list string, b, elB *bolt.Bucket, seqBytes []byte, data interface{}) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	seq := common.BytesToSeq(seqBytes)
+	var old []byte
+	if v := elB.Get(seqBytes); v != nil {
+		old = append([]byte(nil), v...)
+		err = addWeight(list, b, seq, old, -1)
+	} else {
+		err = addCount(b, elB, seq, 1)
+	}
+	if err != nil {
+		return err
+	}
+	err = addWeight(list, b, seq, encoded, 1)
+	if err != nil {
+		return err
+	}
+	err = elB.Put(seqBytes, encoded)
+	if err != nil {
+		return err
+	}
+	err = updateIndexes(b, seqBytes, old, encoded)
+	if err != nil {
+		return err
+	}
+	err = nextVersion(b, seqBytes)
+	if err != nil {
+		return err
+	}
+	if _id, ok := common.ExtractID(data); ok {
+		err = common.SetSeqToIDRef(seqBytes, []byte(_id), b)
+		if err != nil {
+			return err
+		}
+		err = saveRevision(list, b, []byte(_id), encoded, getVersion(b, seqBytes))
+		if err != nil {
+			return err
+		}
+	}
+	return reserveSeq(list, b, elB, seq)
+}
+
+// deleteElement removes element by the sequence and its _id index records, removal is saved to the element history
+func deleteElement(list string, b, elB *bolt.Bucket, seqBytes []byte) error {
+	v := elB.Get(seqBytes)
+	if v == nil {
+		return nil
+	}
+	err := updateIndexes(b, seqBytes, append([]byte(nil), v...), nil)
+	if err != nil {
+		return err
+	}
+	err = addCount(b, elB, common.BytesToSeq(seqBytes), -1)
+	if err != nil {
+		return err
+	}
+	err = addWeight(list, b, common.BytesToSeq(seqBytes), v, -1)
+	if err != nil {
+		return err
+	}
+	err = elB.Delete(seqBytes)
+	if err != nil {
+		return err
+	}
+	err = deleteVersion(b, seqBytes)
+	if err != nil {
+		return err
+	}
+	sb := b.Bucket(common.SeqToIDBucket)
+	if sb == nil {
+		return nil
+	}
+	if id := sb.Get(seqBytes); id != nil {
+		id = append([]byte(nil), id...)
+		if ib := b.Bucket(common.IDToSeqBucket); ib != nil {
+			err = ib.Delete(id)
+			if err != nil {
+				return err
+			}
+		}
+		err = saveRevision(list, b, id, nil, 0)
+		if err != nil {
+			return err
+		}
+	}
+	return sb.Delete(seqBytes)
+}
+
+// moveElement moves element to the new sequence and keeps _id index records in sync.
+// Element is decoded if the list has secondary indexes or if it moves to another block of the list with weight field.
+func moveElement(list string, b, elB *bolt.Bucket, from, to []byte) error {
+	v := elB.Get(from)
+	if v == nil {
+		return common.ErrNotFound
+	}
+	encoded := append([]byte(nil), v...)
+	if block(common.BytesToSeq(from)) != block(common.BytesToSeq(to)) {
+		err := addCount(b, elB, common.BytesToSeq(from), -1)
+		if err != nil {
+			return err
+		}
+		err = addCount(b, elB, common.BytesToSeq(to), 1)
+		if err != nil {
+			return err
+		}
+		err = addWeight(list, b, common.BytesToSeq(from), encoded, -1)
+		if err != nil {
+			return err
+		}
+		err = addWeight(list, b, common.BytesToSeq(to), encoded, 1)
+		if err != nil {
+			return err
+		}
+	}
+	err := elB.Delete(from)
+	if err != nil {
+		return err
+	}
+	err = elB.Put(to, encoded)
+	if err != nil {
+		return err
+	}
+	err = moveIndexes(b, from, to, encoded)
+	if err != nil {
+		return err
+	}
+	err = moveVersion(b, from, to)
+	if err != nil {
+		return err
+	}
+	if sb := b.Bucket(common.SeqToIDBucket); sb != nil {
+		if v := sb.Get(from); v != nil {
+			id := append([]byte(nil), v...)
+			err = sb.Delete(from)
+			if err != nil {
+				return err
+			}
+			err = common.SetSeqToIDRef(to, id, b)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return reserveSeq(list, b, elB, common.BytesToSeq(to))
+}
+
+// reserveSeq moves list sequences to guarantee that PushBack and PushFront will never reuse the passed sequence
+func reserveSeq(list string, b, elB *bolt.Bucket, seq uint64) error {
+	if seq > common.ZeroPoint && seq-common.ZeroPoint > elB.Sequence() {
+		err := elB.SetSequence(seq - common.ZeroPoint)
+		if err != nil {
+			return err
+		}
+	}
+	stats, err := getStat(list, b)
+	if err != nil {
+		return err
+	}
+	if seq <= stats.PrevSequence {
+		stats.PrevSequence = seq - 1
+		return saveStat(stats, b)
+	}
+	return nil
+}
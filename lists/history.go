@@ -0,0 +1,237 @@
+package lists
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/getblank/blank-queue/common"
+)
+
+var (
+	// historyBucket stores element revisions keyed by _id, zero byte and the bucket sequence
+	historyBucket = []byte("_history")
+	// historyDeletedBucket stores removed elements which history is kept, keyed by removal time and _id, see deletedKey
+	historyDeletedBucket = []byte("_historyDeleted")
+)
+
+var errInvalidHistoryDepth = errors.New("invalid history depth")
+
+// Revision is the element state saved in the history.
+// Deleted revision is saved when element is removed from the list, it has no element.
+type Revision struct {
+	Element   json.RawMessage `json:"element,omitempty"`
+	Version   uint64          `json:"version"`
+	Deleted   bool            `json:"deleted,omitempty"`
+	UpdatedAt time.Time       `json:"updatedAt"`
+}
+
+// GetByIDAsOf returns element with provided _id property and it's version as it was at the passed time.
+// Only the period covered by the element history is available, common.ErrNotFound is returned for other times
+// and for times when element was removed.
+func GetByIDAsOf(list string, _id string, at time.Time) (data interface{}, version uint64, err error) {
+	revisions, err := History(list, _id)
+	if err != nil {
+		return nil, 0, err
+	}
+	var found *Revision
+	for _, r := range revisions {
+		if r.UpdatedAt.After(at) {
+			break
+		}
+		found = r
+	}
+	if found == nil || found.Deleted {
+		return nil, 0, common.ErrNotFound
+	}
+	err = json.Unmarshal(found.Element, &data)
+	if err != nil {
+		return nil, 0, err
+	}
+	return data, found.Version, nil
+}
+
+// History returns saved revisions of the element with provided _id property from the oldest to the newest one
+func History(list string, _id string) (revisions []*Revision, err error) {
+	revisions = []*Revision{}
+	err = db.View(func(tx *bolt.Tx) error {
+		b, _, err := listBuckets(tx, list)
+		if err != nil {
+			return err
+		}
+		hB := b.Bucket(historyBucket)
+		if hB == nil {
+			return nil
+		}
+		prefix := historyPrefix([]byte(_id))
+		c := hB.Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			r := &Revision{}
+			err := json.Unmarshal(v, r)
+			if err != nil {
+				return err
+			}
+			revisions = append(revisions, r)
+		}
+		return nil
+	})
+	return revisions, err
+}
+
+// SetHistory sets number of the previous revisions kept for every element of the list.
+// Zero depth disables history, already saved revisions are kept.
+// Revisions of removed elements are purged after the trash retention of the list.
+func SetHistory(list string, depth int) error {
+	if depth < 0 {
+		return errInvalidHistoryDepth
+	}
+	return db.Update(func(tx *bolt.Tx) error {
+		b, _, err := createListBuckets(tx, list)
+		if err != nil {
+			return err
+		}
+		stats, err := getStat(list, b)
+		if err != nil {
+			return err
+		}
+		stats.History = depth
+		return saveStat(stats, b)
+	})
+}
+
+// saveRevision saves element revision if history is enabled for the list and removes revisions exceeding history depth.
+// Nil encoded element means that element was removed.
+func saveRevision(list string, b *bolt.Bucket, id []byte, encoded []byte, version uint64) error {
+	stats, err := getStat(list, b)
+	if err != nil || stats.History == 0 {
+		return err
+	}
+	r := &Revision{Version: version, Deleted: encoded == nil, UpdatedAt: time.Now()}
+	if encoded != nil {
+		r.Element = json.RawMessage(encoded)
+	}
+	v, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	hB, err := b.CreateBucketIfNotExists(historyBucket)
+	if err != nil {
+		return err
+	}
+	dB, err := b.CreateBucketIfNotExists(historyDeletedBucket)
+	if err != nil {
+		return err
+	}
+	prefix := historyPrefix(id)
+	var keys [][]byte
+	var lastValue []byte
+	c := hB.Cursor()
+	for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+		keys = append(keys, append([]byte(nil), k...))
+		lastValue = v
+	}
+	if lastValue != nil {
+		var last Revision
+		err = json.Unmarshal(lastValue, &last)
+		if err != nil {
+			return err
+		}
+		if last.Deleted {
+			err = dB.Delete(deletedKey(last.UpdatedAt, id))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	if r.Deleted {
+		err = dB.Put(deletedKey(r.UpdatedAt, id), nil)
+		if err != nil {
+			return err
+		}
+	}
+	seq, err := hB.NextSequence()
+	if err != nil {
+		return err
+	}
+	key := append(prefix, uint64ToBytes(seq)...)
+	err = hB.Put(key, v)
+	if err != nil {
+		return err
+	}
+	keys = append(keys, key)
+	// current revision and history depth previous ones are kept
+	for len(keys) > stats.History+1 {
+		err = hB.Delete(keys[0])
+		if err != nil {
+			return err
+		}
+		keys = keys[1:]
+	}
+	return nil
+}
+
+// purgeHistory removes all revisions of the elements removed before the passed time, up to limit elements.
+// Returns number of the elements which history was purged.
+func purgeHistory(b *bolt.Bucket, before time.Time, limit int) (int, error) {
+	hB := b.Bucket(historyBucket)
+	if hB == nil {
+		return 0, nil
+	}
+	return purgeDeleted(b.Bucket(historyDeletedBucket), before, limit, func(id []byte) error {
+		prefix := historyPrefix(id)
+		var keys [][]byte
+		c := hB.Cursor()
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			keys = append(keys, append([]byte(nil), k...))
+		}
+		for _, k := range keys {
+			err := hB.Delete(k)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// purgeDeleted removes entries of the index bucket with removal time before the passed one, up to limit entries,
+// and calls purge with _id of each removed entry. Index keys are made by deletedKey.
+func purgeDeleted(dB *bolt.Bucket, before time.Time, limit int, purge func(id []byte) error) (n int, err error) {
+	if dB == nil {
+		return 0, nil
+	}
+	var keys [][]byte
+	c := dB.Cursor()
+	for k, _ := c.First(); k != nil && len(keys) < limit && int64(binary.BigEndian.Uint64(k)) < before.UnixNano(); k, _ = c.Next() {
+		keys = append(keys, append([]byte(nil), k...))
+	}
+	for _, k := range keys {
+		err = dB.Delete(k)
+		if err != nil {
+			return n, err
+		}
+		err = purge(k[8:])
+		if err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
+// deletedKey returns key of the removed element index, it is 8 bytes of removal time (unix nanoseconds) and _id
+func deletedKey(at time.Time, id []byte) []byte {
+	key := make([]byte, 8, 8+len(id))
+	binary.BigEndian.PutUint64(key, uint64(at.UnixNano()))
+	return append(key, id...)
+}
+
+func historyPrefix(id []byte) []byte {
+	prefix := make([]byte, 0, len(id)+9)
+	prefix = append(prefix, id...)
+	return append(prefix, 0)
+}
@@ -0,0 +1,311 @@
+package lists
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/getblank/blank-queue/common"
+)
+
+var (
+	indexDefsBucket     = []byte("_indexDefs")
+	indexesBucket       = []byte("_indexes")
+	errIndexNotExists   = errors.New("index is not exists")
+	errInvalidIndexName = errors.New("invalid index field")
+	errNotIndexable     = errors.New("value can't be indexed")
+)
+
+// index value types in the order of sorting
+const (
+	indexNull byte = iota + 1
+	indexFalse
+	indexTrue
+	indexNumber
+	indexString
+)
+
+// Index describes secondary index on the field of list elements
+type Index struct {
+	Field  string `json:"field"`
+	Unique bool   `json:"unique"`
+}
+
+// CreateIndex creates secondary index on the field of list elements and fills it with existing elements.
+// Field is a dot separated path to the property. Only null, boolean, number and string values are indexed.
+// Unique index works as a constraint, writes of elements with already indexed value fail with *UniqueError.
+func CreateIndex(list, field string, unique bool) error {
+	if field == "" {
+		return errInvalidIndexName
+	}
+	return db.Update(func(tx *bolt.Tx) error {
+		b, elB, err := createListBuckets(tx, list)
+		if err != nil {
+			return err
+		}
+		defB, err := b.CreateBucketIfNotExists(indexDefsBucket)
+		if err != nil {
+			return err
+		}
+		if defB.Get([]byte(field)) != nil {
+			return common.ErrExists
+		}
+		idx := &Index{field, unique}
+		encoded, err := json.Marshal(idx)
+		if err != nil {
+			return err
+		}
+		err = defB.Put([]byte(field), encoded)
+		if err != nil {
+			return err
+		}
+		ib, err := b.CreateBucketIfNotExists(indexesBucket)
+		if err != nil {
+			return err
+		}
+		_, err = ib.CreateBucket([]byte(field))
+		if err != nil {
+			return err
+		}
+		return elB.ForEach(func(k, v []byte) error {
+			var data interface{}
+			if err := json.Unmarshal(v, &data); err != nil {
+				return err
+			}
+			return idx.add(b, k, data)
+		})
+	})
+}
+
+// DropIndex removes secondary index
+func DropIndex(list, field string) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(list))
+		if b == nil {
+			return common.ErrNotFound
+		}
+		defB := b.Bucket(indexDefsBucket)
+		if defB == nil || defB.Get([]byte(field)) == nil {
+			return errIndexNotExists
+		}
+		err := defB.Delete([]byte(field))
+		if err != nil {
+			return err
+		}
+		return b.Bucket(indexesBucket).DeleteBucket([]byte(field))
+	})
+}
+
+// FindBy returns all elements which field is equal to the value using secondary index
+func FindBy(list, field string, value interface{}) ([]*Item, error) {
+	key, ok := encodeIndexValue(value)
+	if !ok {
+		return nil, errNotIndexable
+	}
+	return findIndexed(list, field, key, key, 0)
+}
+
+// FindRange returns up to limit elements which field is between min and max inclusive ordered by the field.
+// Values of different types are ordered as null, false, true, numbers, strings.
+// Nil min or max means that range is not bounded. Zero limit means no limit.
+func FindRange(list, field string, min, max interface{}, limit int) ([]*Item, error) {
+	var from, to []byte
+	var ok bool
+	if min != nil {
+		if from, ok = encodeIndexValue(min); !ok {
+			return nil, errNotIndexable
+		}
+	}
+	if max != nil {
+		if to, ok = encodeIndexValue(max); !ok {
+			return nil, errNotIndexable
+		}
+	}
+	return findIndexed(list, field, from, to, limit)
+}
+
+// Indexes returns all secondary indexes of the list
+func Indexes(list string) (indexes []*Index, err error) {
+	indexes = []*Index{}
+	err = db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(list))
+		if b == nil {
+			return common.ErrNotFound
+		}
+		indexes, err = getIndexes(b)
+		return err
+	})
+	return indexes, err
+}
+
+func findIndexed(list, field string, from, to []byte, limit int) (items []*Item, err error) {
+	items = []*Item{}
+	err = db.View(func(tx *bolt.Tx) error {
+		b, elB, err := listBuckets(tx, list)
+		if err != nil {
+			return err
+		}
+		ib := b.Bucket(indexesBucket)
+		if ib == nil || ib.Bucket([]byte(field)) == nil {
+			return errIndexNotExists
+		}
+		c := ib.Bucket([]byte(field)).Cursor()
+		k, _ := c.First()
+		if from != nil {
+			k, _ = c.Seek(from)
+		}
+		for ; k != nil && (limit == 0 || len(items) < limit); k, _ = c.Next() {
+			value, seqBytes := splitIndexKey(k)
+			if to != nil && bytes.Compare(value, to) > 0 {
+				break
+			}
+			item := &Item{Position: int(common.BytesToSeq(seqBytes) - common.ZeroPoint)}
+			err = json.Unmarshal(elB.Get(seqBytes), &item.Element)
+			if err != nil {
+				return err
+			}
+			items = append(items, item)
+		}
+		return nil
+	})
+	return items, err
+}
+
+func getIndexes(b *bolt.Bucket) ([]*Index, error) {
+	indexes := []*Index{}
+	defB := b.Bucket(indexDefsBucket)
+	if defB == nil {
+		return indexes, nil
+	}
+	err := defB.ForEach(func(k, v []byte) error {
+		idx := new(Index)
+		if err := json.Unmarshal(v, idx); err != nil {
+			return err
+		}
+		indexes = append(indexes, idx)
+		return nil
+	})
+	return indexes, err
+}
+
+// updateIndexes removes index records of the old element value and adds records of the new one.
+// Nil oldValue or newValue means that element is created or removed.
+func updateIndexes(b *bolt.Bucket, seqBytes, oldValue, newValue []byte) error {
+	indexes, err := getIndexes(b)
+	if err != nil || len(indexes) == 0 {
+		return err
+	}
+	var oldData, newData interface{}
+	if oldValue != nil {
+		if err = json.Unmarshal(oldValue, &oldData); err != nil {
+			return err
+		}
+	}
+	if newValue != nil {
+		if err = json.Unmarshal(newValue, &newData); err != nil {
+			return err
+		}
+	}
+	for _, idx := range indexes {
+		if oldValue != nil {
+			if err = idx.remove(b, seqBytes, oldData); err != nil {
+				return err
+			}
+		}
+		if newValue != nil {
+			if err = idx.add(b, seqBytes, newData); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// moveIndexes rewrites index records of the moved element
+func moveIndexes(b *bolt.Bucket, from, to, value []byte) error {
+	indexes, err := getIndexes(b)
+	if err != nil || len(indexes) == 0 {
+		return err
+	}
+	var data interface{}
+	if err = json.Unmarshal(value, &data); err != nil {
+		return err
+	}
+	for _, idx := range indexes {
+		if err = idx.remove(b, from, data); err != nil {
+			return err
+		}
+		if err = idx.add(b, to, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (idx *Index) add(b *bolt.Bucket, seqBytes []byte, data interface{}) error {
+	key, ok := idx.key(data)
+	if !ok {
+		return nil
+	}
+	sb := b.Bucket(indexesBucket).Bucket([]byte(idx.Field))
+	if idx.Unique {
+		c := sb.Cursor()
+		prefix := append(key, 0)
+		for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+			if _, seq := splitIndexKey(k); !bytes.Equal(seq, seqBytes) {
+				return newUniqueError(b, idx.Field, data, seq)
+			}
+		}
+	}
+	return sb.Put(indexKey(key, seqBytes), []byte{})
+}
+
+func (idx *Index) remove(b *bolt.Bucket, seqBytes []byte, data interface{}) error {
+	key, ok := idx.key(data)
+	if !ok {
+		return nil
+	}
+	return b.Bucket(indexesBucket).Bucket([]byte(idx.Field)).Delete(indexKey(key, seqBytes))
+}
+
+func (idx *Index) key(data interface{}) ([]byte, bool) {
+	v, ok := common.GetField(data, idx.Field)
+	if !ok {
+		return nil, false
+	}
+	return encodeIndexValue(v)
+}
+
+// encodeIndexValue encodes value to the bytes which are sorted in the same order as values
+func encodeIndexValue(v interface{}) ([]byte, bool) {
+	switch x := v.(type) {
+	case nil:
+		return []byte{indexNull}, true
+	case bool:
+		if x {
+			return []byte{indexTrue}, true
+		}
+		return []byte{indexFalse}, true
+	case string:
+		return append([]byte{indexString}, x...), true
+	}
+	f, ok := common.ToFloat(v)
+	if !ok {
+		return nil, false
+	}
+	return append([]byte{indexNumber}, common.FloatToBytes(f)...), true
+}
+
+func indexKey(value, seqBytes []byte) []byte {
+	key := make([]byte, 0, len(value)+len(seqBytes)+1)
+	key = append(key, value...)
+	key = append(key, 0)
+	return append(key, seqBytes...)
+}
+
+func splitIndexKey(k []byte) (value, seqBytes []byte) {
+	i := bytes.LastIndexByte(k, 0)
+	return k[:i], k[i+1:]
+}
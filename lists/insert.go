@@ -0,0 +1,145 @@
+package lists
+
+import (
+	"github.com/boltdb/bolt"
+
+	"github.com/getblank/blank-queue/common"
+)
+
+// InsertAfter inserts element after the element with provided sequence number and returns sequence number of the inserted element.
+// If there is no free sequence number between neighbours, the nearest elements will be shifted to make room for the new one,
+// mapping of their positions is passed to the OnRemap handler.
+func InsertAfter(list string, n int, data interface{}) (int, error) {
+	return insert(list, data, true, func(b *bolt.Bucket) ([]byte, error) {
+		return common.SeqToBytes(common.IntToUint(n)), nil
+	})
+}
+
+// InsertAfterByID inserts element after the element with provided _id property and returns sequence number of the inserted element
+func InsertAfterByID(list string, _id string, data interface{}) (int, error) {
+	return insert(list, data, true, func(b *bolt.Bucket) ([]byte, error) {
+		return common.GetEncodedSeqByID(list, []byte(_id), b)
+	})
+}
+
+// InsertBefore inserts element before the element with provided sequence number and returns sequence number of the inserted element.
+// If there is no free sequence number between neighbours, the nearest elements will be shifted to make room for the new one,
+// mapping of their positions is passed to the OnRemap handler.
+func InsertBefore(list string, n int, data interface{}) (int, error) {
+	return insert(list, data, false, func(b *bolt.Bucket) ([]byte, error) {
+		return common.SeqToBytes(common.IntToUint(n)), nil
+	})
+}
+
+// InsertBeforeByID inserts element before the element with provided _id property and returns sequence number of the inserted element
+func InsertBeforeByID(list string, _id string, data interface{}) (int, error) {
+	return insert(list, data, false, func(b *bolt.Bucket) ([]byte, error) {
+		return common.GetEncodedSeqByID(list, []byte(_id), b)
+	})
+}
+
+func insert(list string, data interface{}, after bool, anchor func(b *bolt.Bucket) ([]byte, error)) (n int, err error) {
+	mapping := map[int]int{}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, elB, err := listBuckets(tx, list)
+		if err != nil {
+			return err
+		}
+		if _id, ok := common.ExtractID(data); ok {
+			if _, err := common.GetEncodedSeqByID(list, []byte(_id), b); err == nil {
+				return common.ErrExists
+			}
+		}
+		seqBytes, err := anchor(b)
+		if err != nil {
+			return err
+		}
+		if elB.Get(seqBytes) == nil {
+			return common.ErrNotFound
+		}
+		seq := common.BytesToSeq(seqBytes)
+		if after {
+			seq, err = makeRoomAfter(list, b, elB, seq, mapping)
+		} else {
+			seq, err = makeRoomBefore(list, b, elB, seq, mapping)
+		}
+		if err != nil {
+			return err
+		}
+		err = putElement(list, b, elB, common.SeqToBytes(seq), data)
+		if err != nil {
+			return err
+		}
+		err = enforceCap(list, b, elB, common.SeqToBytes(seq))
+		if err != nil {
+			return err
+		}
+		n = int(seq - common.ZeroPoint)
+		return nil
+	})
+	if err == nil {
+		pushNotifier.Notify(list)
+		notifyRemap(list, mapping)
+	}
+	return n, err
+}
+
+// makeRoomAfter returns free sequence right after the passed one.
+// If it is occupied, shortest run of the consecutive elements around is shifted by one and their positions are added to the mapping.
+func makeRoomAfter(list string, b, elB *bolt.Bucket, seq uint64, mapping map[int]int) (uint64, error) {
+	if elB.Get(common.SeqToBytes(seq+1)) == nil {
+		return seq + 1, nil
+	}
+	forward := runLength(elB, seq+1, true)
+	backward := runLength(elB, seq, false)
+	if forward <= backward {
+		for s := seq + forward; s > seq; s-- {
+			err := shiftElement(list, b, elB, s, s+1, mapping)
+			if err != nil {
+				return 0, err
+			}
+		}
+		return seq + 1, nil
+	}
+	for s := seq - backward + 1; s <= seq; s++ {
+		err := shiftElement(list, b, elB, s, s-1, mapping)
+		if err != nil {
+			return 0, err
+		}
+	}
+	return seq, nil
+}
+
+// makeRoomBefore returns free sequence right before the passed one, see makeRoomAfter
+func makeRoomBefore(list string, b, elB *bolt.Bucket, seq uint64, mapping map[int]int) (uint64, error) {
+	if elB.Get(common.SeqToBytes(seq-1)) == nil {
+		return seq - 1, nil
+	}
+	return makeRoomAfter(list, b, elB, seq-1, mapping)
+}
+
+func shiftElement(list string, b, elB *bolt.Bucket, from, to uint64, mapping map[int]int) error {
+	err := moveElement(list, b, elB, common.SeqToBytes(from), common.SeqToBytes(to))
+	if err != nil {
+		return err
+	}
+	mapping[int(from-common.ZeroPoint)] = int(to - common.ZeroPoint)
+	return nil
+}
+
+// runLength returns number of the consecutive elements starting from the passed sequence
+func runLength(elB *bolt.Bucket, seq uint64, forward bool) (n uint64) {
+	c := elB.Cursor()
+	k, _ := c.Seek(common.SeqToBytes(seq))
+	for k != nil && common.BytesToSeq(k) == seq {
+		n++
+		if forward {
+			seq++
+			k, _ = c.Next()
+		} else {
+			seq--
+			k, _ = c.Prev()
+		}
+	}
+	return n
+}
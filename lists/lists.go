@@ -6,6 +6,7 @@ import (
 	"errors"
 	"os"
 	"os/signal"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/boltdb/bolt"
@@ -24,8 +25,17 @@ var (
 )
 
 type stat struct {
-	Marked       []uint64 `json:"marked"`
-	PrevSequence uint64   `json:"prevSequence"`
+	Marked       []uint64      `json:"marked"`
+	PrevSequence uint64        `json:"prevSequence"`
+	Cap          *Cap          `json:"cap,omitempty"`
+	History      int           `json:"history,omitempty"`
+	Partitioning *Partitioning `json:"partitioning,omitempty"`
+	// PartitionLens keeps number of elements in partitions by the partition start unix time
+	PartitionLens map[int64]int `json:"partitionLens,omitempty"`
+	// TrashRetention overrides default trashRetention of the list
+	TrashRetention time.Duration `json:"trashRetention,omitempty"`
+	WeightField    string        `json:"weightField,omitempty"`
+	CompactedAt    time.Time     `json:"compactedAt,omitempty"`
 }
 
 // Init is the main entrypoint for the package
@@ -47,6 +57,8 @@ func Init(file string) {
 		}
 	}()
 	log.Info("Lists DB started")
+	go sweepTrash()
+	go sweepPartitions()
 }
 
 // Back returns last element and it's sequence number
@@ -56,13 +68,9 @@ func Back(list string) (data interface{}, seq int, err error) {
 		return nil, 0, errListIsEmpty
 	}
 	err = db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(list))
-		if b == nil {
-			return common.ErrNotFound
-		}
-		elB := b.Bucket(common.ElementsBucket)
-		if elB == nil {
-			return common.ErrNotFound
+		_, elB, err := listBuckets(tx, list)
+		if err != nil {
+			return err
 		}
 		c := elB.Cursor()
 		k, v := c.Last()
@@ -73,7 +81,7 @@ func Back(list string) (data interface{}, seq int, err error) {
 		seq = int(_seq - common.ZeroPoint)
 		return json.Unmarshal(v, &data)
 	})
-	return data, seq, nil
+	return data, seq, err
 }
 
 func Drop(list string) (err error) {
@@ -95,13 +103,9 @@ func Front(list string) (data interface{}, seq int, err error) {
 		return nil, 0, errListIsEmpty
 	}
 	err = db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(list))
-		if b == nil {
-			return common.ErrNotFound
-		}
-		elB := b.Bucket(common.ElementsBucket)
-		if elB == nil {
-			return common.ErrNotFound
+		_, elB, err := listBuckets(tx, list)
+		if err != nil {
+			return err
 		}
 		c := elB.Cursor()
 		k, v := c.First()
@@ -112,7 +116,7 @@ func Front(list string) (data interface{}, seq int, err error) {
 		seq = int(_seq - common.ZeroPoint)
 		return json.Unmarshal(v, &data)
 	})
-	return data, seq, nil
+	return data, seq, err
 }
 
 // Get returns element by provided sequence number
@@ -122,13 +126,9 @@ func Get(list string, n int) (data interface{}, err error) {
 		return nil, errListIsEmpty
 	}
 	err = db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(list))
-		if b == nil {
-			return common.ErrNotFound
-		}
-		elB := b.Bucket(common.ElementsBucket)
-		if elB == nil {
-			return common.ErrNotFound
+		_, elB, err := listBuckets(tx, list)
+		if err != nil {
+			return err
 		}
 		seq := uint64(n) + common.ZeroPoint
 		seqBytes := common.SeqToBytes(seq)
@@ -148,13 +148,9 @@ func GetByID(list string, _id string) (data interface{}, n int, err error) {
 		return nil, 0, errListIsEmpty
 	}
 	err = db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(list))
-		if b == nil {
-			return common.ErrNotFound
-		}
-		elB := b.Bucket(common.ElementsBucket)
-		if elB == nil {
-			return common.ErrNotFound
+		b, elB, err := listBuckets(tx, list)
+		if err != nil {
+			return err
 		}
 		id := []byte(_id)
 		seqBytes, err := common.GetEncodedSeqByID(list, id, b)
@@ -178,6 +174,14 @@ func Len(list string) (l uint64) {
 		if b == nil {
 			return common.ErrNotFound
 		}
+		if b.Bucket(partitionsBucket) != nil {
+			stats, err := readStat(b)
+			if err != nil {
+				return err
+			}
+			l = partitionsLen(stats)
+			return nil
+		}
 		elB := b.Bucket(common.ElementsBucket)
 		if elB == nil {
 			return common.ErrNotFound
@@ -192,45 +196,23 @@ func Len(list string) (l uint64) {
 // Returns error if it can't add element
 func PushBack(list string, data interface{}) (n int, err error) {
 	err = db.Update(func(tx *bolt.Tx) error {
-		b, err := tx.CreateBucketIfNotExists([]byte(list))
-		if err != nil {
+		if b := tx.Bucket([]byte(list)); b != nil && b.Bucket(partitionsBucket) != nil {
+			n, err = pushPartitioned(list, b, data)
 			return err
 		}
-		elB, err := b.CreateBucketIfNotExists(common.ElementsBucket)
+		b, elB, err := createListBuckets(tx, list)
 		if err != nil {
 			return err
 		}
-		var idBytes, seqBytes []byte
-		if _id, ok := common.ExtractID(data); ok {
-			idBytes = []byte(_id)
-			_, err = common.GetEncodedSeqByID(list, idBytes, b)
-			if err == nil {
-				return common.ErrExists
-			}
-		}
-		seq, err := nextShiftedSequence(elB)
+		n, err = pushBack(list, b, elB, data)
 		if err != nil {
 			return err
 		}
-		seqBytes = common.SeqToBytes(seq)
-		encoded, err := json.Marshal(data)
-		if err != nil {
-			return err
-		}
-		err = elB.Put(seqBytes, encoded)
-		if err != nil {
-			return err
-		}
-		if idBytes != nil {
-			err = common.SetSeqToIDRef(seqBytes, idBytes, b)
-			if err != nil {
-				return err
-			}
-		}
-
-		n = int(seq - common.ZeroPoint)
-		return nil
+		return enforceCap(list, b, elB, common.SeqToBytes(uint64(n)+common.ZeroPoint))
 	})
+	if err == nil {
+		pushNotifier.Notify(list)
+	}
 	return n, err
 }
 
@@ -238,18 +220,12 @@ func PushBack(list string, data interface{}) (n int, err error) {
 // Returns error if it can't add element
 func PushFront(list string, data interface{}) (n int, err error) {
 	err = db.Update(func(tx *bolt.Tx) error {
-		b, err := tx.CreateBucketIfNotExists([]byte(list))
-		if err != nil {
-			return err
-		}
-		elB, err := b.CreateBucketIfNotExists(common.ElementsBucket)
+		b, elB, err := createListBuckets(tx, list)
 		if err != nil {
 			return err
 		}
-		var idBytes, seqBytes []byte
 		if _id, ok := common.ExtractID(data); ok {
-			idBytes = []byte(_id)
-			_, err = common.GetEncodedSeqByID(list, idBytes, b)
+			_, err = common.GetEncodedSeqByID(list, []byte(_id), b)
 			if err == nil {
 				return common.ErrExists
 			}
@@ -258,25 +234,21 @@ func PushFront(list string, data interface{}) (n int, err error) {
 		if err != nil {
 			return err
 		}
-		seqBytes = common.SeqToBytes(seq)
-		encoded, err := json.Marshal(data)
+		err = putElement(list, b, elB, common.SeqToBytes(seq), data)
 		if err != nil {
 			return err
 		}
-		err = elB.Put(seqBytes, encoded)
+		err = enforceCap(list, b, elB, common.SeqToBytes(seq))
 		if err != nil {
 			return err
 		}
-		if idBytes != nil {
-			err = common.SetSeqToIDRef(seqBytes, idBytes, b)
-			if err != nil {
-				return err
-			}
-		}
 
 		n = int(seq - common.ZeroPoint)
 		return nil
 	})
+	if err == nil {
+		pushNotifier.Notify(list)
+	}
 	return n, err
 }
 
@@ -284,36 +256,12 @@ func PushFront(list string, data interface{}) (n int, err error) {
 // Returns error if queue is not exists or it can't write changes
 func Remove(list string, n int) (err error) {
 	err = db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(list))
-		if b == nil {
-			return common.ErrNotFound
-		}
-		elB := b.Bucket(common.ElementsBucket)
-		if elB == nil {
-			return common.ErrNotFound
-		}
-		seq := uint64(n) + common.ZeroPoint
-		seqBytes := common.SeqToBytes(seq)
-		err := elB.Delete(seqBytes)
+		b, elB, err := listBuckets(tx, list)
 		if err != nil {
 			return err
 		}
-		sb := b.Bucket(common.SeqToIDBucket)
-		if sb != nil {
-			id := sb.Get(seqBytes)
-			if id != nil {
-				sb := b.Bucket(common.IDToSeqBucket)
-				err = sb.Delete(id)
-				if err != nil {
-					return err
-				}
-			}
-			err = sb.Delete(seqBytes)
-			if err != nil {
-				return err
-			}
-		}
-		return nil
+		seq := uint64(n) + common.ZeroPoint
+		return deleteElement(list, b, elB, common.SeqToBytes(seq))
 	})
 	return err
 }
@@ -322,38 +270,16 @@ func Remove(list string, n int) (err error) {
 // Returns error if queue is not exists or it can't write changes
 func RemoveByID(list string, _id string) (err error) {
 	err = db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(list))
-		if b == nil {
-			return common.ErrNotFound
-		}
-		elB := b.Bucket(common.ElementsBucket)
-		if elB == nil {
-			return common.ErrNotFound
-		}
-		id := []byte(_id)
-		seqBytes, err := common.GetEncodedSeqByID(list, id, b)
+		b, elB, err := listBuckets(tx, list)
 		if err != nil {
 			return err
 		}
-		err = elB.Delete(seqBytes)
+		id := []byte(_id)
+		seqBytes, err := common.GetEncodedSeqByID(list, id, b)
 		if err != nil {
 			return err
 		}
-		sb := b.Bucket(common.SeqToIDBucket)
-		if sb != nil {
-			err = sb.Delete(seqBytes)
-			if err != nil {
-				return err
-			}
-		}
-		sb = b.Bucket(common.IDToSeqBucket)
-		if sb != nil {
-			err = sb.Delete(id)
-			if err != nil {
-				return err
-			}
-		}
-		return nil
+		return deleteElement(list, b, elB, seqBytes)
 	})
 	return err
 }
@@ -362,41 +288,29 @@ func RemoveByID(list string, _id string) (err error) {
 // Returns error if queue is not exists or if item was not found it can't write changes
 func UpdateByID(list string, data interface{}) (err error) {
 	err = db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(list))
-		if b == nil {
-			return common.ErrNotFound
+		b, elB, err := listBuckets(tx, list)
+		if err != nil {
+			return err
 		}
 		_id, ok := common.ExtractID(data)
 		if !ok {
 			return common.ErrNoIDInTheElement
 		}
-		elB := b.Bucket(common.ElementsBucket)
-		if elB == nil {
-			return common.ErrNotFound
-		}
 		id := []byte(_id)
 		seqBytes, err := common.GetEncodedSeqByID(list, id, b)
 		if err != nil {
 			return err
 		}
-		encoded, err := json.Marshal(data)
-		if err != nil {
-			return err
-		}
-		return elB.Put(seqBytes, encoded)
+		return putElement(list, b, elB, seqBytes, data)
 	})
 	return err
 }
 
 func Next(list string, _n int) (data interface{}, n int, err error) {
 	err = db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(list))
-		if b == nil {
-			return common.ErrNotFound
-		}
-		elB := b.Bucket(common.ElementsBucket)
-		if elB == nil {
-			return common.ErrNotFound
+		_, elB, err := listBuckets(tx, list)
+		if err != nil {
+			return err
 		}
 		seq := uint64(_n) + common.ZeroPoint
 		seqBytes := common.SeqToBytes(seq)
@@ -421,13 +335,9 @@ func Next(list string, _n int) (data interface{}, n int, err error) {
 
 func Prev(list string, _n int) (data interface{}, n int, err error) {
 	err = db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(list))
-		if b == nil {
-			return common.ErrNotFound
-		}
-		elB := b.Bucket(common.ElementsBucket)
-		if elB == nil {
-			return common.ErrNotFound
+		_, elB, err := listBuckets(tx, list)
+		if err != nil {
+			return err
 		}
 		seq := uint64(_n) + common.ZeroPoint
 		seqBytes := common.SeqToBytes(seq)
@@ -446,6 +356,25 @@ func Prev(list string, _n int) (data interface{}, n int, err error) {
 	return data, n, err
 }
 
+// pushBack stores element after the last one, returns common.ErrExists if element with the same _id is already in the list
+func pushBack(list string, b, elB *bolt.Bucket, data interface{}) (int, error) {
+	if _id, ok := common.ExtractID(data); ok {
+		_, err := common.GetEncodedSeqByID(list, []byte(_id), b)
+		if err == nil {
+			return 0, common.ErrExists
+		}
+	}
+	seq, err := nextShiftedSequence(elB)
+	if err != nil {
+		return 0, err
+	}
+	err = putElement(list, b, elB, common.SeqToBytes(seq), data)
+	if err != nil {
+		return 0, err
+	}
+	return int(seq - common.ZeroPoint), nil
+}
+
 // nextShiftedSequence return next sequence for passed bucked shifted by ZeroPoint
 func nextShiftedSequence(b *bolt.Bucket) (uint64, error) {
 	s, err := b.NextSequence()
@@ -456,7 +385,7 @@ func nextShiftedSequence(b *bolt.Bucket) (uint64, error) {
 }
 
 func newStat() *stat {
-	return &stat{[]uint64{}, common.ZeroPoint}
+	return &stat{Marked: []uint64{}, PrevSequence: common.ZeroPoint}
 }
 
 // need to pass parent bucket
@@ -487,6 +416,22 @@ func getStat(list string, b *bolt.Bucket) (*stat, error) {
 		if err != nil {
 			return nil, err
 		}
+		lists[list] = stats
+	}
+	return stats, nil
+}
+
+// readStat decodes private copy of the stored list stat. It must be used in read transactions instead of getStat,
+// because getStat caches the stat which is changed by writers.
+func readStat(b *bolt.Bucket) (*stat, error) {
+	stats := newStat()
+	encoded := b.Get(common.StatBytes)
+	if encoded == nil {
+		return stats, nil
+	}
+	err := json.Unmarshal(encoded, stats)
+	if err != nil {
+		return nil, err
 	}
 	return stats, nil
 }
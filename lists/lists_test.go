@@ -1,9 +1,14 @@
 package lists
 
 import (
+	"encoding/binary"
 	"os"
+	"sort"
+	"strconv"
 	"testing"
+	"time"
 
+	"github.com/boltdb/bolt"
 	. "github.com/franela/goblin"
 	"github.com/getblank/blank-queue/common"
 )
@@ -261,5 +266,1256 @@ func Test(t *testing.T) {
 		})
 	})
 
+	g.Describe("#InsertAfter", func() {
+		g.It("should insert element between neighbours shifting following elements", func() {
+			list := "InsertAfterListTest"
+			PushBack(list, "testData1")
+			PushBack(list, "testData3")
+			PushBack(list, "testData4")
+			PushFront(list, "testData0")
+
+			n, err := InsertAfter(list, 1, "testData2")
+			g.Assert(err == nil).IsTrue()
+			g.Assert(n).Equal(2)
+			g.Assert(elements(list)).Equal([]interface{}{"testData0", "testData1", "testData2", "testData3", "testData4"})
+
+			n, err = PushBack(list, "testData5")
+			g.Assert(err == nil).IsTrue()
+			g.Assert(n).Equal(5)
+			n, err = PushFront(list, "testData-1")
+			g.Assert(err == nil).IsTrue()
+			g.Assert(n).Equal(-1)
+		})
+
+		g.It("should pass positions of the shifted elements to the remap handler", func() {
+			list := "InsertAfterRemapListTest"
+			PushBack(list, "testData1")
+			PushBack(list, "testData2")
+			PushBack(list, "testData4")
+			PushBack(list, "testData5")
+			PushBack(list, "testData6")
+			var remapped map[int]int
+			OnRemap(func(l string, mapping map[int]int) {
+				if l == list {
+					remapped = mapping
+				}
+			})
+			defer OnRemap(nil)
+
+			n, err := InsertAfter(list, 2, "testData3")
+			g.Assert(err == nil).IsTrue()
+			g.Assert(n).Equal(2)
+			g.Assert(remapped).Equal(map[int]int{1: 0, 2: 1})
+			g.Assert(elements(list)).Equal([]interface{}{"testData1", "testData2", "testData3", "testData4", "testData5", "testData6"})
+			e, err := Get(list, 1)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(e).Equal("testData2")
+
+			remapped = nil
+			_, err = PushBack(list, "testData7")
+			g.Assert(err == nil).IsTrue()
+			g.Assert(remapped == nil).IsTrue()
+		})
+
+		g.It("should insert element after element with provided _id", func() {
+			list := "InsertAfterByIDListTest"
+			PushBack(list, map[string]interface{}{"_id": "1"})
+			PushBack(list, map[string]interface{}{"_id": "3"})
+
+			_, err := InsertAfterByID(list, "1", map[string]interface{}{"_id": "2"})
+			g.Assert(err == nil).IsTrue()
+			_, err = InsertAfterByID(list, "3", map[string]interface{}{"_id": "4"})
+			g.Assert(err == nil).IsTrue()
+			g.Assert(elements(list)).Equal([]interface{}{
+				map[string]interface{}{"_id": "1"},
+				map[string]interface{}{"_id": "2"},
+				map[string]interface{}{"_id": "3"},
+				map[string]interface{}{"_id": "4"},
+			})
+			_, n, err := GetByID(list, "3")
+			g.Assert(err == nil).IsTrue()
+			e, err := Get(list, n)
+			g.Assert(e).Equal(map[string]interface{}{"_id": "3"})
+		})
+
+		g.It("should return error if anchor element was not found or element exists", func() {
+			list := "InsertAfterByIDListTest"
+			_, err := InsertAfterByID(list, "20", "testData")
+			g.Assert(err).Equal(common.ErrNotFound)
+			_, err = InsertAfter(list, 20, "testData")
+			g.Assert(err).Equal(common.ErrNotFound)
+			_, err = InsertAfterByID(list, "1", map[string]interface{}{"_id": "2"})
+			g.Assert(err).Equal(common.ErrExists)
+		})
+	})
+
+	g.Describe("#InsertBefore", func() {
+		g.It("should insert element before the element with provided position or _id", func() {
+			list := "InsertBeforeListTest"
+			PushBack(list, map[string]interface{}{"_id": "1"})
+			PushBack(list, map[string]interface{}{"_id": "3"})
+
+			_, err := InsertBeforeByID(list, "3", map[string]interface{}{"_id": "2"})
+			g.Assert(err == nil).IsTrue()
+			n, err := InsertBefore(list, 1, map[string]interface{}{"_id": "0"})
+			g.Assert(err == nil).IsTrue()
+			g.Assert(n).Equal(0)
+			for i := 0; i < 10; i++ {
+				_, err = InsertBeforeByID(list, "3", i)
+				g.Assert(err == nil).IsTrue()
+			}
+			all := elements(list)
+			g.Assert(len(all)).Equal(14)
+			g.Assert(all[2]).Equal(map[string]interface{}{"_id": "2"})
+			g.Assert(all[12]).Equal(float64(9))
+			g.Assert(all[13]).Equal(map[string]interface{}{"_id": "3"})
+		})
+	})
+
+	g.Describe("#Range", func() {
+		g.It("should return page of elements and position to continue from", func() {
+			list := "RangeListTest"
+			for i := 1; i <= 5; i++ {
+				PushBack(list, i)
+			}
+			items, next, err := Range(list, nil, 2, false)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(items).Equal([]*Item{{float64(1), 1}, {float64(2), 2}})
+			g.Assert(*next).Equal(3)
+			items, next, err = Range(list, next, 3, false)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(items)).Equal(3)
+			g.Assert(items[2]).Equal(&Item{float64(5), 5})
+			g.Assert(next == nil).IsTrue()
+		})
+
+		g.It("should return elements in reverse order", func() {
+			list := "RangeListTest"
+			items, next, err := Range(list, nil, 2, true)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(items).Equal([]*Item{{float64(5), 5}, {float64(4), 4}})
+			g.Assert(*next).Equal(3)
+			from := 10
+			items, next, err = Range(list, &from, 1, true)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(items).Equal([]*Item{{float64(5), 5}})
+		})
+
+		g.It("should return error if list was not found", func() {
+			_, _, err := Range("RangeListNotExistsTest", nil, 2, false)
+			g.Assert(err).Equal(common.ErrNotFound)
+		})
+	})
+
+	g.Describe("#Slice", func() {
+		g.It("should return elements by offset and limit", func() {
+			list := "RangeListTest"
+			items, err := Slice(list, 3, 5)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(items).Equal([]*Item{{float64(4), 4}, {float64(5), 5}})
+		})
+	})
+
+	g.Describe("#At", func() {
+		g.It("should return element by ordinal index", func() {
+			list := "AtListTest"
+			for i := 0; i < 1200; i++ {
+				if i%2 == 0 {
+					PushBack(list, i)
+				} else {
+					PushFront(list, i)
+				}
+			}
+			Remove(list, 0)
+			e, n, err := At(list, 0)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(e).Equal(float64(1199))
+			g.Assert(n).Equal(-599)
+			e, n, err = At(list, 600)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(e).Equal(float64(2))
+			g.Assert(n).Equal(2)
+			e, n, err = At(list, -1)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(e).Equal(float64(1198))
+			g.Assert(n).Equal(600)
+			_, _, err = At(list, 1199)
+			g.Assert(err).Equal(errOutOfRange)
+			_, _, err = At(list, -1200)
+			g.Assert(err).Equal(errOutOfRange)
+		})
+	})
+
+	g.Describe("#Rank", func() {
+		g.It("should return ordinal index of the element by _id", func() {
+			list := "RankListTest"
+			for i := 0; i < 5; i++ {
+				PushBack(list, map[string]interface{}{"_id": strconv.Itoa(i)})
+			}
+			InsertAfterByID(list, "2", map[string]interface{}{"_id": "2.5"})
+			RemoveByID(list, "0")
+			index, err := Rank(list, "2.5")
+			g.Assert(err == nil).IsTrue()
+			g.Assert(index).Equal(2)
+			index, err = Rank(list, "4")
+			g.Assert(err == nil).IsTrue()
+			g.Assert(index).Equal(4)
+			_, err = Rank(list, "0")
+			g.Assert(err).Equal(common.ErrNotFound)
+		})
+	})
+
+	g.Describe("#CreateIndex", func() {
+		g.It("should index existing and new elements", func() {
+			list := "IndexListTest"
+			PushBack(list, map[string]interface{}{"_id": "1", "user": map[string]interface{}{"email": "a@a"}, "age": 30})
+			PushBack(list, map[string]interface{}{"_id": "2", "user": map[string]interface{}{"email": "b@b"}, "age": -5})
+			err := CreateIndex(list, "user.email", true)
+			g.Assert(err == nil).IsTrue()
+			err = CreateIndex(list, "age", false)
+			g.Assert(err == nil).IsTrue()
+			err = CreateIndex(list, "age", false)
+			g.Assert(err).Equal(common.ErrExists)
+			PushFront(list, map[string]interface{}{"_id": "3", "user": map[string]interface{}{"email": "c@c"}, "age": 30})
+			PushBack(list, map[string]interface{}{"_id": "4", "age": 1.5})
+
+			items, err := FindBy(list, "user.email", "b@b")
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(items)).Equal(1)
+			g.Assert(items[0].Position).Equal(2)
+			items, err = FindBy(list, "age", 30)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(items)).Equal(2)
+			items, err = FindRange(list, "age", -10, 2, 0)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(items)).Equal(2)
+			g.Assert(items[0].Element.(map[string]interface{})["_id"]).Equal("2")
+			g.Assert(items[1].Element.(map[string]interface{})["_id"]).Equal("4")
+			items, err = FindRange(list, "age", 0, nil, 0)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(items)).Equal(3)
+		})
+
+		g.It("should keep index in sync on update, insert and remove", func() {
+			list := "IndexListTest"
+			err := UpdateByID(list, map[string]interface{}{"_id": "2", "user": map[string]interface{}{"email": "bb@b"}})
+			g.Assert(err == nil).IsTrue()
+			items, _ := FindBy(list, "user.email", "b@b")
+			g.Assert(len(items)).Equal(0)
+			items, _ = FindBy(list, "user.email", "bb@b")
+			g.Assert(len(items)).Equal(1)
+			_, err = InsertAfterByID(list, "1", map[string]interface{}{"_id": "5", "age": 30})
+			g.Assert(err == nil).IsTrue()
+			RemoveByID(list, "3")
+			items, _ = FindBy(list, "age", 30)
+			g.Assert(len(items)).Equal(2)
+			for _, item := range items {
+				e, _ := Get(list, item.Position)
+				g.Assert(e).Equal(item.Element)
+			}
+		})
+
+		g.It("should reject elements violating unique index", func() {
+			list := "IndexListTest"
+			_, err := PushBack(list, map[string]interface{}{"_id": "6", "user": map[string]interface{}{"email": "a@a"}})
+			g.Assert(err).Equal(&UniqueError{Field: "user.email", Value: "a@a", ID: "1"})
+			g.Assert(Len(list)).Equal(uint64(4))
+			err = CreateIndex(list, "age", true)
+			g.Assert(err).Equal(common.ErrExists)
+			err = DropIndex(list, "age")
+			g.Assert(err == nil).IsTrue()
+			_, err = FindBy(list, "age", 30)
+			g.Assert(err).Equal(errIndexNotExists)
+			err = CreateIndex(list, "age", true)
+			uErr, ok := err.(*UniqueError)
+			g.Assert(ok).IsTrue()
+			g.Assert(uErr.Field).Equal("age")
+		})
+
+		g.It("should name the field and conflicting _id in the unique error", func() {
+			list := "IndexListTest"
+			_, err := PushFront(list, map[string]interface{}{"_id": "7", "user": map[string]interface{}{"email": "bb@b"}})
+			g.Assert(err).Equal(&UniqueError{Field: "user.email", Value: "bb@b", ID: "2"})
+			g.Assert(err.Error()).Equal(`{"error":"unique constraint violation","field":"user.email","value":"bb@b","_id":"2"}`)
+			err = UpdateByID(list, map[string]interface{}{"_id": "1", "user": map[string]interface{}{"email": "bb@b"}})
+			g.Assert(err).Equal(&UniqueError{Field: "user.email", Value: "bb@b", ID: "2"})
+			e, _, _ := GetByID(list, "1")
+			g.Assert(e.(map[string]interface{})["user"]).Equal(map[string]interface{}{"email": "a@a"})
+		})
+	})
+
+	g.Describe("#Trim", func() {
+		g.It("should remove elements from the front or back and keep _id index consistent", func() {
+			list := "TrimListTest"
+			for i := 0; i < 10; i++ {
+				PushBack(list, map[string]interface{}{"_id": strconv.Itoa(i)})
+			}
+			removed, err := Trim(list, 7, TrimFront)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(removed).Equal(3)
+			removed, err = Trim(list, 5, TrimBack)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(removed).Equal(2)
+			g.Assert(Len(list)).Equal(uint64(5))
+			_, _, err = GetByID(list, "2")
+			g.Assert(err).Equal(common.ErrNotFound)
+			_, _, err = GetByID(list, "8")
+			g.Assert(err).Equal(common.ErrNotFound)
+			e, _, err := Front(list)
+			g.Assert(e).Equal(map[string]interface{}{"_id": "3"})
+			_, err = PushBack(list, map[string]interface{}{"_id": "2"})
+			g.Assert(err == nil).IsTrue()
+		})
+	})
+
+	g.Describe("#SetCap", func() {
+		g.It("should enforce max length on push", func() {
+			list := "CapListTest"
+			for i := 0; i < 5; i++ {
+				PushBack(list, i)
+			}
+			removed, err := SetCap(list, &Cap{MaxLen: 3, From: TrimFront})
+			g.Assert(err == nil).IsTrue()
+			g.Assert(removed).Equal(2)
+			PushBack(list, 5)
+			PushBack(list, 6)
+			g.Assert(elements(list)).Equal([]interface{}{float64(4), float64(5), float64(6)})
+			_, err = SetCap(list, nil)
+			g.Assert(err == nil).IsTrue()
+			PushBack(list, 7)
+			g.Assert(Len(list)).Equal(uint64(4))
+			_, err = SetCap(list, &Cap{MaxLen: 3, From: "middle"})
+			g.Assert(err).Equal(errInvalidCap)
+		})
+		g.It("should reject zero cap and push of the element evicted by the cap", func() {
+			list := "CapEvictListTest"
+			_, err := SetCap(list, &Cap{MaxLen: 0, From: TrimBack})
+			g.Assert(err).Equal(errInvalidCap)
+			_, err = SetCap(list, &Cap{MaxLen: 2, From: TrimBack})
+			g.Assert(err == nil).IsTrue()
+			PushBack(list, 0)
+			PushBack(list, 1)
+			_, err = PushBack(list, 2)
+			g.Assert(err).Equal(errEvictedByCap)
+			g.Assert(elements(list)).Equal([]interface{}{float64(0), float64(1)})
+			_, err = PushFront(list, -1)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(elements(list)).Equal([]interface{}{float64(-1), float64(0)})
+		})
+	})
+
+	g.Describe("#PatchByID", func() {
+		g.It("should apply merge patch to the element", func() {
+			list := "PatchListTest"
+			PushBack(list, map[string]interface{}{"_id": "1", "a": "a", "b": map[string]interface{}{"c": 1, "d": 2}})
+			e, err := PatchByID(list, "1", map[string]interface{}{"a": nil, "b": map[string]interface{}{"c": 3}, "e": true})
+			g.Assert(err == nil).IsTrue()
+			expected := map[string]interface{}{"_id": "1", "b": map[string]interface{}{"c": float64(3), "d": float64(2)}, "e": true}
+			g.Assert(e).Equal(expected)
+			e, _, _ = GetByID(list, "1")
+			g.Assert(e).Equal(expected)
+		})
+
+		g.It("should not allow to change _id", func() {
+			list := "PatchListTest"
+			_, err := PatchByID(list, "1", map[string]interface{}{"_id": "2"})
+			g.Assert(err).Equal(errIDChanged)
+			_, err = PatchByID(list, "2", map[string]interface{}{"a": 1})
+			g.Assert(err).Equal(common.ErrNotFound)
+		})
+	})
+
+	g.Describe("#ModifyByID", func() {
+		g.It("should apply field operations atomically", func() {
+			list := "ModifyListTest"
+			PushBack(list, map[string]interface{}{"_id": "1", "counter": 1, "tags": []interface{}{"a"}})
+			e, err := ModifyByID(list, "1", []*FieldOp{
+				{Op: OpInc, Field: "counter", Value: 2},
+				{Op: OpInc, Field: "stats.views", Value: 1},
+				{Op: OpPush, Field: "tags", Value: "b"},
+				{Op: OpSetIfAbsent, Field: "counter", Value: 100},
+				{Op: OpSetIfAbsent, Field: "owner", Value: "me"},
+			})
+			g.Assert(err == nil).IsTrue()
+			g.Assert(e).Equal(map[string]interface{}{
+				"_id":     "1",
+				"counter": float64(3),
+				"stats":   map[string]interface{}{"views": float64(1)},
+				"tags":    []interface{}{"a", "b"},
+				"owner":   "me",
+			})
+			_, err = ModifyByID(list, "1", []*FieldOp{
+				{Op: OpInc, Field: "counter", Value: 1},
+				{Op: OpInc, Field: "owner", Value: 1},
+			})
+			g.Assert(err).Equal(errInvalidOperation)
+			e, _, _ = GetByID(list, "1")
+			g.Assert(e.(map[string]interface{})["counter"]).Equal(float64(3))
+		})
+	})
+
+	g.Describe("#Versions", func() {
+		g.It("should increase element version on every update", func() {
+			list := "VersionsListTest"
+			n, _ := PushBack(list, map[string]interface{}{"_id": "1"})
+			PushBack(list, map[string]interface{}{"_id": "2"})
+			_, v1, err := GetWithVersion(list, n)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(v1 > 0).IsTrue()
+			v2, err := UpdateByIDIfVersion(list, map[string]interface{}{"_id": "1", "a": 1}, v1)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(v2 > v1).IsTrue()
+			_, err = PatchByID(list, "1", map[string]interface{}{"a": 2})
+			g.Assert(err == nil).IsTrue()
+			e, pos, v3, err := GetByIDWithVersion(list, "1")
+			g.Assert(err == nil).IsTrue()
+			g.Assert(pos).Equal(n)
+			g.Assert(v3 > v2).IsTrue()
+			g.Assert(e).Equal(map[string]interface{}{"_id": "1", "a": float64(2)})
+		})
+
+		g.It("should reject update and remove with stale version", func() {
+			list := "VersionsListTest"
+			_, _, v, _ := GetByIDWithVersion(list, "1")
+			_, err := UpdateByIDIfVersion(list, map[string]interface{}{"_id": "1", "a": 3}, v-1)
+			g.Assert(err).Equal(errVersionConflict)
+			err = RemoveByIDIfVersion(list, "1", v-1)
+			g.Assert(err).Equal(errVersionConflict)
+			e, _, _ := GetByID(list, "1")
+			g.Assert(e).Equal(map[string]interface{}{"_id": "1", "a": float64(2)})
+			err = RemoveByIDIfVersion(list, "1", v)
+			g.Assert(err == nil).IsTrue()
+			_, _, err = GetByID(list, "1")
+			g.Assert(err).Equal(common.ErrNotFound)
+		})
+
+		g.It("should keep version when element is moved", func() {
+			list := "VersionsMoveListTest"
+			versions := map[string]uint64{}
+			positions := map[string]int{}
+			for _, id := range []string{"1", "2", "3"} {
+				PushBack(list, map[string]interface{}{"_id": id})
+				_, positions[id], versions[id], _ = GetByIDWithVersion(list, id)
+			}
+			_, err := InsertBefore(list, positions["2"], map[string]interface{}{"_id": "4"})
+			g.Assert(err == nil).IsTrue()
+			moved := 0
+			for _, id := range []string{"1", "2", "3"} {
+				_, n, v, _ := GetByIDWithVersion(list, id)
+				if n != positions[id] {
+					moved++
+				}
+				g.Assert(v).Equal(versions[id])
+			}
+			g.Assert(moved > 0).IsTrue()
+		})
+	})
+
+	g.Describe("#UpsertByID", func() {
+		g.It("should append missing element and update existing one in place", func() {
+			list := "UpsertListTest"
+			PushBack(list, map[string]interface{}{"_id": "1"})
+			n, inserted, err := UpsertByID(list, map[string]interface{}{"_id": "2", "a": 1})
+			g.Assert(err == nil).IsTrue()
+			g.Assert(inserted).IsTrue()
+			PushBack(list, map[string]interface{}{"_id": "3"})
+			updated, inserted, err := UpsertByID(list, map[string]interface{}{"_id": "2", "a": 2})
+			g.Assert(err == nil).IsTrue()
+			g.Assert(inserted).IsFalse()
+			g.Assert(updated).Equal(n)
+			e, _ := Get(list, n)
+			g.Assert(e).Equal(map[string]interface{}{"_id": "2", "a": float64(2)})
+			g.Assert(Len(list)).Equal(uint64(3))
+			_, _, err = UpsertByID(list, map[string]interface{}{"a": 3})
+			g.Assert(err).Equal(common.ErrNoIDInTheElement)
+		})
+	})
+
+	g.Describe("#ReplaceAll", func() {
+		g.It("should replace all elements of the list", func() {
+			list := "ReplaceAllListTest"
+			PushBack(list, map[string]interface{}{"_id": "1"})
+			PushBack(list, map[string]interface{}{"_id": "2"})
+			err := ReplaceAll(list, []interface{}{
+				map[string]interface{}{"_id": "2", "a": 1},
+				map[string]interface{}{"_id": "3"},
+			})
+			g.Assert(err == nil).IsTrue()
+			g.Assert(elements(list)).Equal([]interface{}{
+				map[string]interface{}{"_id": "2", "a": float64(1)},
+				map[string]interface{}{"_id": "3"},
+			})
+			_, _, err = GetByID(list, "1")
+			g.Assert(err).Equal(common.ErrNotFound)
+		})
+
+		g.It("should keep list untouched if elements are invalid", func() {
+			list := "ReplaceAllListTest"
+			err := ReplaceAll(list, []interface{}{
+				map[string]interface{}{"_id": "4"},
+				map[string]interface{}{"_id": "4"},
+			})
+			g.Assert(err).Equal(common.ErrExists)
+			g.Assert(elements(list)).Equal([]interface{}{
+				map[string]interface{}{"_id": "2", "a": float64(1)},
+				map[string]interface{}{"_id": "3"},
+			})
+		})
+	})
+
+	g.Describe("#Move", func() {
+		ids := func(list string) []string {
+			res := []string{}
+			for _, e := range elements(list) {
+				res = append(res, e.(map[string]interface{})["_id"].(string))
+			}
+			return res
+		}
+
+		g.It("should move element to the front and to the back", func() {
+			list := "MoveListTest"
+			for _, id := range []string{"1", "2", "3", "4"} {
+				PushBack(list, map[string]interface{}{"_id": id})
+			}
+			_, _, v, _ := GetByIDWithVersion(list, "3")
+			n, err := MoveToFront(list, "3")
+			g.Assert(err == nil).IsTrue()
+			g.Assert(ids(list)).Equal([]string{"3", "1", "2", "4"})
+			_, pos, moved, _ := GetByIDWithVersion(list, "3")
+			g.Assert(pos).Equal(n)
+			g.Assert(moved).Equal(v)
+			_, err = MoveToBack(list, "1")
+			g.Assert(err == nil).IsTrue()
+			g.Assert(ids(list)).Equal([]string{"3", "2", "4", "1"})
+			_, err = MoveToBack(list, "1")
+			g.Assert(err == nil).IsTrue()
+			g.Assert(ids(list)).Equal([]string{"3", "2", "4", "1"})
+			_, err = MoveToFront(list, "5")
+			g.Assert(err).Equal(common.ErrNotFound)
+		})
+
+		g.It("should move element after the provided position", func() {
+			list := "MoveListTest"
+			_, after, _ := GetByID(list, "2")
+			_, err := Move(list, "1", after)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(ids(list)).Equal([]string{"3", "2", "1", "4"})
+			_, after, _ = GetByID(list, "4")
+			n, err := Move(list, "3", after)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(ids(list)).Equal([]string{"2", "1", "4", "3"})
+			_, pos, _ := GetByID(list, "3")
+			g.Assert(pos).Equal(n)
+			_, err = Move(list, "3", -1000)
+			g.Assert(err).Equal(common.ErrNotFound)
+		})
+	})
+
+	g.Describe("#Pop", func() {
+		g.It("should remove and return elements from both sides", func() {
+			list := "PopListTest"
+			first, _ := PushBack(list, map[string]interface{}{"_id": "1"})
+			PushBack(list, map[string]interface{}{"_id": "2"})
+			last, _ := PushBack(list, map[string]interface{}{"_id": "3"})
+			e, n, err := PopFront(list)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(n).Equal(first)
+			g.Assert(e).Equal(map[string]interface{}{"_id": "1"})
+			e, n, err = PopBack(list)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(n).Equal(last)
+			g.Assert(e).Equal(map[string]interface{}{"_id": "3"})
+			_, _, err = GetByID(list, "3")
+			g.Assert(err).Equal(common.ErrNotFound)
+			PopFront(list)
+			_, _, err = PopBack(list)
+			g.Assert(err).Equal(errListIsEmpty)
+			_, _, err = PopFront("NotExistingPopListTest")
+			g.Assert(err).Equal(errListIsEmpty)
+		})
+
+		g.It("should wait for the pushed element", func() {
+			list := "PopWaitListTest"
+			go func() {
+				time.Sleep(50 * time.Millisecond)
+				PushBack(list, map[string]interface{}{"_id": "1"})
+			}()
+			e, _, err := PopFrontWait(list, time.Second)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(e).Equal(map[string]interface{}{"_id": "1"})
+		})
+
+		g.It("should return error when timeout is reached", func() {
+			list := "PopWaitListTest"
+			started := time.Now()
+			_, _, err := PopBackWait(list, 50*time.Millisecond)
+			g.Assert(err).Equal(errListIsEmpty)
+			g.Assert(time.Since(started) >= 50*time.Millisecond).IsTrue()
+		})
+	})
+
+	g.Describe("#Query", func() {
+		list := "QueryListTest"
+		g.Before(func() {
+			PushBack(list, map[string]interface{}{"_id": "1", "status": "active", "score": 5, "user": map[string]interface{}{"name": "b"}})
+			PushBack(list, map[string]interface{}{"_id": "2", "status": "closed", "score": 7})
+			PushBack(list, map[string]interface{}{"_id": "3", "status": "active", "score": 9, "user": map[string]interface{}{"name": "a"}})
+			PushBack(list, map[string]interface{}{"_id": "4", "status": "active"})
+		})
+
+		g.It("should return matching elements in the list order", func() {
+			items, err := Query(list, map[string]interface{}{"status": "active", "score": map[string]interface{}{"$gt": 5}}, "", nil, 0)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(items)).Equal(1)
+			g.Assert(items[0].Element.(map[string]interface{})["_id"]).Equal("3")
+			items, _ = Query(list, map[string]interface{}{"$or": []interface{}{
+				map[string]interface{}{"status": "closed"},
+				map[string]interface{}{"score": map[string]interface{}{"$exists": false}},
+			}}, "", nil, 0)
+			g.Assert(len(items)).Equal(2)
+			g.Assert(items[0].Element.(map[string]interface{})["_id"]).Equal("2")
+			g.Assert(items[1].Element.(map[string]interface{})["_id"]).Equal("4")
+		})
+
+		g.It("should sort, project and limit elements", func() {
+			items, err := Query(list, nil, "-score", []string{"_id", "user.name"}, 3)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(items)).Equal(3)
+			g.Assert(items[0].Element).Equal(map[string]interface{}{"_id": "3", "user": map[string]interface{}{"name": "a"}})
+			g.Assert(items[1].Element).Equal(map[string]interface{}{"_id": "2"})
+			g.Assert(items[2].Element).Equal(map[string]interface{}{"_id": "1", "user": map[string]interface{}{"name": "b"}})
+			e, _ := Get(list, items[0].Position)
+			g.Assert(e.(map[string]interface{})["_id"]).Equal("3")
+			items, _ = Query(list, nil, "user.name", []string{"_id"}, 0)
+			g.Assert(items[0].Element).Equal(map[string]interface{}{"_id": "3"})
+			g.Assert(items[1].Element).Equal(map[string]interface{}{"_id": "1"})
+			g.Assert(len(items)).Equal(4)
+		})
+
+		g.It("should return error for invalid filter", func() {
+			_, err := Query(list, map[string]interface{}{"score": map[string]interface{}{"$regex": "a"}}, "", nil, 0)
+			g.Assert(err).Equal(common.ErrInvalidFilter)
+		})
+	})
+
+	g.Describe("#Aggregate", func() {
+		list := "AggregateListTest"
+		g.Before(func() {
+			PushBack(list, map[string]interface{}{"status": "active", "score": 5, "name": "b"})
+			PushBack(list, map[string]interface{}{"status": "closed", "score": 7})
+			PushBack(list, map[string]interface{}{"status": "active", "score": 9, "name": "a"})
+			PushBack(list, map[string]interface{}{"status": "active"})
+			PushBack(list, map[string]interface{}{"score": 1})
+		})
+
+		g.It("should calculate aggregations per group", func() {
+			groups, err := Aggregate(list, "status", []*Aggregation{
+				{Op: AggCount},
+				{Op: AggSum, Field: "score"},
+				{Op: AggAvg, Field: "score", As: "avg"},
+				{Op: AggMin, Field: "score"},
+				{Op: AggMax, Field: "name"},
+			}, nil)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(groups)).Equal(3)
+			g.Assert(groups[0].Key).Equal("active")
+			g.Assert(groups[0].Values).Equal(map[string]interface{}{
+				"count":     3,
+				"sum_score": float64(14),
+				"avg":       float64(7),
+				"min_score": float64(5),
+				"max_name":  "b",
+			})
+			g.Assert(groups[1].Key).Equal("closed")
+			g.Assert(groups[1].Values["max_name"] == nil).IsTrue()
+			g.Assert(groups[2].Key == nil).IsTrue()
+			g.Assert(groups[2].Values["count"]).Equal(1)
+		})
+
+		g.It("should aggregate filtered elements into one group", func() {
+			groups, err := Aggregate(list, "", []*Aggregation{{Op: AggCount}, {Op: AggAvg, Field: "score"}},
+				map[string]interface{}{"score": map[string]interface{}{"$gte": 5}})
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(groups)).Equal(1)
+			g.Assert(groups[0].Values).Equal(map[string]interface{}{"count": 3, "avg_score": float64(7)})
+		})
+
+		g.It("should return error for invalid aggregation", func() {
+			_, err := Aggregate(list, "", []*Aggregation{{Op: AggSum}}, nil)
+			g.Assert(err).Equal(errInvalidAggregation)
+			_, err = Aggregate(list, "", []*Aggregation{{Op: "median", Field: "score"}}, nil)
+			g.Assert(err).Equal(errInvalidAggregation)
+		})
+	})
+
+	g.Describe("#SetOperations", func() {
+		ids := func(elements []interface{}) []string {
+			res := []string{}
+			for _, e := range elements {
+				res = append(res, e.(map[string]interface{})["_id"].(string))
+			}
+			return res
+		}
+		g.Before(func() {
+			for _, id := range []string{"1", "2", "3", "4"} {
+				PushBack("SentListTest", map[string]interface{}{"_id": id, "list": "sent"})
+			}
+			for _, id := range []string{"5", "3", "1"} {
+				PushBack("PendingListTest", map[string]interface{}{"_id": id, "list": "pending"})
+			}
+			PushBack("PendingListTest", map[string]interface{}{"list": "pending"})
+			PushBack("FailedListTest", map[string]interface{}{"_id": "3"})
+		})
+
+		g.It("should return union of the lists", func() {
+			res, err := Union([]string{"SentListTest", "PendingListTest"}, "")
+			g.Assert(err == nil).IsTrue()
+			g.Assert(ids(res)).Equal([]string{"1", "2", "3", "4", "5"})
+			g.Assert(res[0].(map[string]interface{})["list"]).Equal("sent")
+		})
+
+		g.It("should return intersection of the lists", func() {
+			res, err := Intersect([]string{"PendingListTest", "SentListTest"}, "")
+			g.Assert(err == nil).IsTrue()
+			g.Assert(ids(res)).Equal([]string{"3", "1"})
+			res, _ = Intersect([]string{"PendingListTest", "SentListTest", "FailedListTest"}, "")
+			g.Assert(ids(res)).Equal([]string{"3"})
+			res, _ = Intersect([]string{"PendingListTest", "NotExistingListTest"}, "")
+			g.Assert(len(res)).Equal(0)
+		})
+
+		g.It("should return difference of the lists", func() {
+			res, err := Diff([]string{"SentListTest", "PendingListTest", "FailedListTest"}, "")
+			g.Assert(err == nil).IsTrue()
+			g.Assert(ids(res)).Equal([]string{"2", "4"})
+			_, err = Diff(nil, "")
+			g.Assert(err).Equal(errNoLists)
+		})
+
+		g.It("should store result into the destination list", func() {
+			PushBack("DiffListTest", map[string]interface{}{"_id": "9"})
+			res, err := Diff([]string{"SentListTest", "PendingListTest"}, "DiffListTest")
+			g.Assert(err == nil).IsTrue()
+			g.Assert(ids(elements("DiffListTest"))).Equal(ids(res))
+			g.Assert(ids(res)).Equal([]string{"2", "4"})
+			_, err = Union([]string{"SentListTest", "DiffListTest"}, "SentListTest")
+			g.Assert(err == nil).IsTrue()
+			g.Assert(ids(elements("SentListTest"))).Equal([]string{"1", "2", "3", "4"})
+		})
+	})
+
+	g.Describe("#Trash", func() {
+		g.It("should move removed elements to the trash", func() {
+			list := "TrashListTest"
+			first, _ := PushBack(list, map[string]interface{}{"_id": "1"})
+			PushBack(list, map[string]interface{}{"_id": "2"})
+			PushBack(list, "noID")
+			err := SoftRemove(list, first)
+			g.Assert(err == nil).IsTrue()
+			err = SoftRemoveByID(list, "2", 0)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(Len(list)).Equal(uint64(1))
+			err = SoftRemove(list, first+2)
+			g.Assert(err).Equal(common.ErrNoIDInTheElement)
+			items, err := Trash(list)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(items)).Equal(2)
+			g.Assert(items[0].Position).Equal(first)
+			g.Assert(string(items[0].Element)).Equal(`{"_id":"1"}`)
+		})
+
+		g.It("should restore element to the original position if it is free", func() {
+			list := "TrashListTest"
+			_, _, err := GetByID(list, "1")
+			g.Assert(err).Equal(common.ErrNotFound)
+			n, err := Restore(list, "1")
+			g.Assert(err == nil).IsTrue()
+			g.Assert(n).Equal(1)
+			e, _ := Get(list, n)
+			g.Assert(e).Equal(map[string]interface{}{"_id": "1"})
+			occupied, _ := InsertAfter(list, n, map[string]interface{}{"_id": "3"})
+			g.Assert(occupied).Equal(2)
+			n, err = Restore(list, "2")
+			g.Assert(err == nil).IsTrue()
+			g.Assert(n).Equal(4)
+			_, err = Restore(list, "2")
+			g.Assert(err).Equal(common.ErrNotFound)
+		})
+
+		g.It("should apply the list cap to the restored element", func() {
+			list := "TrashCapListTest"
+			PushBack(list, map[string]interface{}{"_id": "1"})
+			PushBack(list, map[string]interface{}{"_id": "2"})
+			err := SoftRemoveByID(list, "1", 0)
+			g.Assert(err == nil).IsTrue()
+			PushBack(list, map[string]interface{}{"_id": "3"})
+			_, err = SetCap(list, &Cap{MaxLen: 2, From: TrimFront})
+			g.Assert(err == nil).IsTrue()
+			_, err = Restore(list, "1")
+			g.Assert(err).Equal(errEvictedByCap)
+			g.Assert(Len(list)).Equal(uint64(2))
+			items, _ := Trash(list)
+			g.Assert(len(items)).Equal(1)
+			_, err = SetCap(list, &Cap{MaxLen: 2, From: TrimBack})
+			g.Assert(err == nil).IsTrue()
+			n, err := Restore(list, "1")
+			g.Assert(err == nil).IsTrue()
+			g.Assert(n).Equal(1)
+			g.Assert(elements(list)).Equal([]interface{}{map[string]interface{}{"_id": "1"}, map[string]interface{}{"_id": "2"}})
+		})
+
+		g.It("should reject duplicate trash entries", func() {
+			list := "TrashDuplicateListTest"
+			PushBack(list, map[string]interface{}{"_id": "1", "v": 1})
+			err := SoftRemoveByID(list, "1", 0)
+			g.Assert(err == nil).IsTrue()
+			PushBack(list, map[string]interface{}{"_id": "1", "v": 2})
+			err = SoftRemoveByID(list, "1", 0)
+			g.Assert(err).Equal(common.ErrExists)
+			g.Assert(Len(list)).Equal(uint64(1))
+			items, _ := Trash(list)
+			g.Assert(len(items)).Equal(1)
+			g.Assert(string(items[0].Element)).Equal(`{"_id":"1","v":1}`)
+		})
+
+		g.It("should purge expired elements", func() {
+			list := "TrashListTest"
+			SoftRemoveByID(list, "1", 0)
+			purged, err := purgeTrash(time.Now())
+			g.Assert(err == nil).IsTrue()
+			g.Assert(purged).Equal(0)
+			purged, err = purgeTrash(time.Now().Add(trashRetention))
+			g.Assert(err == nil).IsTrue()
+			g.Assert(purged).Equal(2)
+			items, _ := Trash(list)
+			g.Assert(len(items)).Equal(0)
+		})
+
+		g.It("should purge elements by the list trash retention", func() {
+			list := "TrashRetentionListTest"
+			PushBack(list, map[string]interface{}{"_id": "1"})
+			g.Assert(SetTrashRetention(list, -time.Hour)).Equal(errInvalidTrashRetention)
+			err := SetTrashRetention(list, time.Hour)
+			g.Assert(err == nil).IsTrue()
+			SoftRemoveByID(list, "1", 0)
+			purged, err := purgeTrash(time.Now().Add(30 * time.Minute))
+			g.Assert(err == nil).IsTrue()
+			g.Assert(purged).Equal(0)
+			purged, err = purgeTrash(time.Now().Add(2 * time.Hour))
+			g.Assert(err == nil).IsTrue()
+			g.Assert(purged).Equal(1)
+		})
+	})
+
+	g.Describe("#History", func() {
+		g.It("should keep previous revisions of the element", func() {
+			list := "HistoryListTest"
+			PushBack(list, map[string]interface{}{"_id": "0"})
+			err := SetHistory(list, 2)
+			g.Assert(err == nil).IsTrue()
+			PushBack(list, map[string]interface{}{"_id": "1", "a": 0})
+			for i := 1; i <= 3; i++ {
+				UpdateByID(list, map[string]interface{}{"_id": "1", "a": i})
+			}
+			revisions, err := History(list, "1")
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(revisions)).Equal(3)
+			g.Assert(string(revisions[0].Element)).Equal(`{"_id":"1","a":1}`)
+			g.Assert(string(revisions[2].Element)).Equal(`{"_id":"1","a":3}`)
+			_, _, v, _ := GetByIDWithVersion(list, "1")
+			g.Assert(revisions[2].Version).Equal(v)
+			revisions, _ = History(list, "0")
+			g.Assert(len(revisions)).Equal(0)
+			g.Assert(SetHistory(list, -1)).Equal(errInvalidHistoryDepth)
+		})
+
+		g.It("should return element as it was at the passed time", func() {
+			list := "HistoryListTest"
+			PushBack(list, map[string]interface{}{"_id": "2", "a": 1})
+			time.Sleep(5 * time.Millisecond)
+			first := time.Now()
+			time.Sleep(5 * time.Millisecond)
+			UpdateByID(list, map[string]interface{}{"_id": "2", "a": 2})
+			time.Sleep(5 * time.Millisecond)
+			second := time.Now()
+			time.Sleep(5 * time.Millisecond)
+			RemoveByID(list, "2")
+
+			e, _, err := GetByIDAsOf(list, "2", first)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(e).Equal(map[string]interface{}{"_id": "2", "a": float64(1)})
+			e, _, _ = GetByIDAsOf(list, "2", second)
+			g.Assert(e).Equal(map[string]interface{}{"_id": "2", "a": float64(2)})
+			_, _, err = GetByIDAsOf(list, "2", time.Now())
+			g.Assert(err).Equal(common.ErrNotFound)
+			_, _, err = GetByIDAsOf(list, "2", first.Add(-time.Hour))
+			g.Assert(err).Equal(common.ErrNotFound)
+		})
+
+		g.It("should purge history of removed elements after the trash retention", func() {
+			list := "HistoryListTest"
+			_, err := purgeTrash(time.Now())
+			g.Assert(err == nil).IsTrue()
+			revisions, _ := History(list, "2")
+			g.Assert(len(revisions)).Equal(3)
+			_, err = purgeTrash(time.Now().Add(trashRetention))
+			g.Assert(err == nil).IsTrue()
+			revisions, _ = History(list, "2")
+			g.Assert(len(revisions)).Equal(0)
+			revisions, _ = History(list, "1")
+			g.Assert(len(revisions)).Equal(3)
+		})
+
+		g.It("should keep history of the element added again after removal", func() {
+			list := "HistoryListTest"
+			PushBack(list, map[string]interface{}{"_id": "3", "a": 1})
+			RemoveByID(list, "3")
+			PushBack(list, map[string]interface{}{"_id": "3", "a": 2})
+			PushBack(list, map[string]interface{}{"_id": "4"})
+			RemoveByID(list, "4")
+			_, err := purgeTrash(time.Now().Add(trashRetention))
+			g.Assert(err == nil).IsTrue()
+			revisions, _ := History(list, "3")
+			g.Assert(len(revisions)).Equal(3)
+			g.Assert(revisions[1].Deleted).IsTrue()
+			revisions, _ = History(list, "4")
+			g.Assert(len(revisions)).Equal(0)
+		})
+	})
+
+	g.Describe("#Random", func() {
+		list := "RandomListTest"
+		g.Before(func() {
+			for i := 0; i < 20; i++ {
+				PushBack(list, map[string]interface{}{"_id": strconv.Itoa(i), "weight": i % 3})
+			}
+		})
+
+		g.It("should return distinct random elements", func() {
+			items, err := Random(list, 5)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(items)).Equal(5)
+			seen := map[int]bool{}
+			for _, item := range items {
+				g.Assert(seen[item.Position]).IsFalse()
+				seen[item.Position] = true
+				e, _ := Get(list, item.Position)
+				g.Assert(e).Equal(item.Element)
+			}
+			items, _ = Random(list, 100)
+			g.Assert(len(items)).Equal(20)
+			_, err = Random(list, 0)
+			g.Assert(err).Equal(errInvalidLimit)
+		})
+
+		g.It("should pick only elements with positive weight", func() {
+			_, err := RandomWeighted(list, 100, "weight")
+			g.Assert(err).Equal(errNoWeightField)
+			err = SetWeightField(list, "weight")
+			g.Assert(err == nil).IsTrue()
+			items, err := RandomWeighted(list, 100, "weight")
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(items)).Equal(13)
+			for _, item := range items {
+				g.Assert(item.Element.(map[string]interface{})["weight"] != float64(0)).IsTrue()
+			}
+			items, _ = RandomWeighted(list, 3, "weight")
+			g.Assert(len(items)).Equal(3)
+		})
+
+		g.It("should keep weight sums in sync with the list changes", func() {
+			UpdateByID(list, map[string]interface{}{"_id": "1", "weight": 0})
+			RemoveByID(list, "2")
+			MoveToFront(list, "4")
+			items, err := RandomWeighted(list, 100, "weight")
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(items)).Equal(11)
+			_, err = RandomWeighted(list, 1, "score")
+			g.Assert(err).Equal(errNoWeightField)
+		})
+
+		g.It("should pick weighted elements while other lists are written", func() {
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for i := 0; i < 20; i++ {
+					PushBack("RandomWeightedConcurrentListTest"+strconv.Itoa(i), i)
+				}
+			}()
+		read:
+			for {
+				select {
+				case <-done:
+					break read
+				default:
+					_, err := RandomWeighted(list, 3, "weight")
+					g.Assert(err == nil).IsTrue()
+				}
+			}
+		})
+
+		g.It("should pick weighted elements across blocks", func() {
+			list := "RandomWeightedBlocksListTest"
+			elements := make([]interface{}, 3000)
+			for i := range elements {
+				elements[i] = map[string]interface{}{"_id": strconv.Itoa(i)}
+			}
+			for _, i := range []int{5, 1500, 2999} {
+				elements[i] = map[string]interface{}{"_id": strconv.Itoa(i), "weight": i + 1}
+			}
+			err := SetWeightField(list, "weight")
+			g.Assert(err == nil).IsTrue()
+			err = ReplaceAll(list, elements)
+			g.Assert(err == nil).IsTrue()
+			items, err := RandomWeighted(list, 5, "weight")
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(items)).Equal(3)
+			picked := []string{}
+			for _, item := range items {
+				picked = append(picked, item.Element.(map[string]interface{})["_id"].(string))
+			}
+			sort.Strings(picked)
+			g.Assert(picked).Equal([]string{"1500", "2999", "5"})
+		})
+	})
+
+	g.Describe("#Partitioned", func() {
+		list := "PartitionedListTest"
+
+		g.It("should create partitioned list", func() {
+			err := CreatePartitioned(list, &Partitioning{Period: "week"})
+			g.Assert(err).Equal(errInvalidPartitioning)
+			err = CreatePartitioned(list, &Partitioning{Period: PartitionHourly, Retention: 2})
+			g.Assert(err == nil).IsTrue()
+			err = CreatePartitioned(list, &Partitioning{Period: PartitionDaily})
+			g.Assert(err).Equal(common.ErrExists)
+		})
+
+		g.It("should push and range elements across partitions", func() {
+			for i := 1; i <= 5; i++ {
+				n, err := PushBack(list, map[string]interface{}{"i": i})
+				g.Assert(err == nil).IsTrue()
+				g.Assert(n).Equal(i)
+			}
+			err := db.Update(func(tx *bolt.Tx) error {
+				// move two first elements to the previous hour partition
+				pB := partitionsOf(tx, list)
+				key := partitionKeys(pB)[0]
+				prev := uint64ToBytes(uint64(time.Now().Truncate(time.Hour).Add(-time.Hour).Unix()))
+				prevB, err := pB.CreateBucket(prev)
+				if err != nil {
+					return err
+				}
+				for i := uint64(1); i <= 2; i++ {
+					prevB.Put(uint64ToBytes(i), pB.Bucket(key).Get(uint64ToBytes(i)))
+					pB.Bucket(key).Delete(uint64ToBytes(i))
+				}
+				b := tx.Bucket([]byte(list))
+				stats, err := getStat(list, b)
+				if err != nil {
+					return err
+				}
+				stats.PartitionLens[int64(binary.BigEndian.Uint64(key))] -= 2
+				stats.PartitionLens[int64(binary.BigEndian.Uint64(prev))] = 2
+				return saveStat(stats, b)
+			})
+			g.Assert(err == nil).IsTrue()
+			partitions, err := Partitions(list)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(partitions)).Equal(2)
+			g.Assert(partitions[0].Len).Equal(2)
+			g.Assert(Len(list)).Equal(uint64(5))
+
+			items, next, err := Range(list, nil, 3, false)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(items)).Equal(3)
+			g.Assert(items[2].Element).Equal(map[string]interface{}{"i": float64(3)})
+			g.Assert(*next).Equal(4)
+			items, next, _ = Range(list, next, 3, false)
+			g.Assert(len(items)).Equal(2)
+			g.Assert(next == nil).IsTrue()
+			from := 3
+			items, next, _ = Range(list, &from, 2, true)
+			g.Assert(items[0].Position).Equal(3)
+			g.Assert(items[1].Position).Equal(2)
+			g.Assert(*next).Equal(1)
+		})
+
+		g.It("should reject operations not supported by partitioned lists", func() {
+			_, err := PushFront(list, "a")
+			g.Assert(err).Equal(errPartitionedList)
+			_, err = Slice(list, 0, 10)
+			g.Assert(err).Equal(errPartitionedList)
+			_, err = SetCap(list, &Cap{MaxLen: 1, From: TrimFront})
+			g.Assert(err).Equal(errPartitionedList)
+			_, _, err = Back(list)
+			g.Assert(err).Equal(errPartitionedList)
+			_, err = Get(list, 1)
+			g.Assert(err).Equal(errPartitionedList)
+			_, _, err = GetByID(list, "1")
+			g.Assert(err).Equal(errPartitionedList)
+			_, _, err = Next(list, 1)
+			g.Assert(err).Equal(errPartitionedList)
+			_, err = InsertAfter(list, 1, "a")
+			g.Assert(err).Equal(errPartitionedList)
+			g.Assert(Remove(list, 1)).Equal(errPartitionedList)
+			_, _, err = PopFront(list)
+			g.Assert(err).Equal(errPartitionedList)
+		})
+
+		g.It("should read partition lengths while pushing concurrently", func() {
+			list := "PartitionedConcurrentListTest"
+			err := CreatePartitioned(list, &Partitioning{Period: PartitionDaily})
+			g.Assert(err == nil).IsTrue()
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for i := 0; i < 20; i++ {
+					PushBack(list, i)
+				}
+			}()
+		read:
+			for {
+				select {
+				case <-done:
+					break read
+				default:
+					Len(list)
+					Partitions(list)
+				}
+			}
+			g.Assert(Len(list)).Equal(uint64(20))
+			partitions, _ := Partitions(list)
+			g.Assert(partitions[len(partitions)-1].Len).Equal(20)
+		})
+
+		g.It("should drop expired partitions", func() {
+			err := db.Update(func(tx *bolt.Tx) error {
+				b := tx.Bucket([]byte(list))
+				stats, err := getStat(list, b)
+				if err != nil {
+					return err
+				}
+				return dropExpiredPartitions(b, partitionsOf(tx, list), stats, time.Now().Add(2*time.Hour))
+			})
+			g.Assert(err == nil).IsTrue()
+			g.Assert(Len(list)).Equal(uint64(3))
+			err = Drop(list)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(Len(list)).Equal(uint64(0))
+		})
+	})
+
+	g.Describe("#Compact", func() {
+		g.It("should renumber elements densely keeping their order", func() {
+			list := "CompactListTest"
+			for _, id := range []string{"1", "2", "3", "4"} {
+				PushBack(list, map[string]interface{}{"_id": id})
+			}
+			PushFront(list, map[string]interface{}{"_id": "0"})
+			PushFront(list, map[string]interface{}{"_id": "-1"})
+			RemoveByID(list, "2")
+			CreateIndex(list, "_id", true)
+			_, _, v, _ := GetByIDWithVersion(list, "4")
+			before := elements(list)
+
+			mapping, err := Compact(list)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(mapping).Equal(map[int]int{-1: 1, 0: 2, 1: 3, 3: 4, 4: 5})
+			g.Assert(elements(list)).Equal(before)
+			_, n, movedVersion, _ := GetByIDWithVersion(list, "4")
+			g.Assert(n).Equal(5)
+			g.Assert(movedVersion).Equal(v)
+			items, _ := FindBy(list, "_id", "3")
+			g.Assert(items[0].Position).Equal(4)
+			index, _ := Rank(list, "3")
+			g.Assert(index).Equal(3)
+		})
+
+		g.It("should continue pushes after compacted elements", func() {
+			list := "CompactListTest"
+			n, _ := PushBack(list, map[string]interface{}{"_id": "5"})
+			g.Assert(n).Equal(6)
+			n, _ = PushFront(list, map[string]interface{}{"_id": "-2"})
+			g.Assert(n).Equal(0)
+			mapping, err := Compact(list)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(mapping)).Equal(7)
+			mapping, _ = Compact(list)
+			g.Assert(len(mapping)).Equal(0)
+		})
+
+		g.It("should compact large list by batches interleaved with writes", func() {
+			list := "CompactBatchesListTest"
+			values := make([]interface{}, compactBatchSize+500)
+			for i := range values {
+				values[i] = float64(i)
+			}
+			err := ReplaceAll(list, values)
+			g.Assert(err == nil).IsTrue()
+			PushFront(list, "front")
+			var batches []int
+			OnRemap(func(l string, mapping map[int]int) {
+				if l != list {
+					return
+				}
+				batches = append(batches, len(mapping))
+				if len(batches) == 1 {
+					// writes between batches must not break the order of the elements
+					PushFront(list, "first")
+					PushBack(list, "last")
+				}
+			})
+			defer OnRemap(nil)
+
+			mapping, err := Compact(list)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(batches) > 1).IsTrue()
+			g.Assert(len(mapping)).Equal(compactBatchSize + 503)
+			g.Assert(mapping[0]).Equal(2)
+			all := []interface{}{"first", "front"}
+			all = append(all, values...)
+			all = append(all, "last")
+			g.Assert(elements(list)).Equal(all)
+			_, first, _ := Front(list)
+			g.Assert(first).Equal(1)
+			n, _ := PushBack(list, "next")
+			g.Assert(n).Equal(compactBatchSize + 504)
+			n, _ = PushFront(list, "previous")
+			g.Assert(n).Equal(0)
+		})
+
+		g.It("should restore elements trashed before compaction to the back of the list", func() {
+			list := "CompactTrashListTest"
+			PushBack(list, map[string]interface{}{"_id": "1"})
+			PushBack(list, map[string]interface{}{"_id": "2"})
+			PushFront(list, map[string]interface{}{"_id": "0"})
+			err := SoftRemoveByID(list, "0", 0)
+			g.Assert(err == nil).IsTrue()
+			_, err = Compact(list)
+			g.Assert(err == nil).IsTrue()
+			n, err := Restore(list, "0")
+			g.Assert(err == nil).IsTrue()
+			g.Assert(n).Equal(3)
+			g.Assert(elements(list)).Equal([]interface{}{
+				map[string]interface{}{"_id": "1"},
+				map[string]interface{}{"_id": "2"},
+				map[string]interface{}{"_id": "0"},
+			})
+			n, _ = PushBack(list, map[string]interface{}{"_id": "3"})
+			g.Assert(n).Equal(4)
+		})
+	})
+
 	os.Remove(fileName)
 }
+
+func elements(list string) []interface{} {
+	res := []interface{}{}
+	e, n, err := Front(list)
+	for err == nil {
+		res = append(res, e)
+		e, n, err = Next(list, n)
+	}
+	return res
+}
@@ -0,0 +1,105 @@
+package lists
+
+import (
+	"github.com/boltdb/bolt"
+
+	"github.com/getblank/blank-queue/common"
+)
+
+// Move moves element with provided _id property right after the element with provided sequence number
+// and returns new sequence number of the moved element. Element is moved as is, without decoding.
+// Elements shifted to make room for the moved one are passed to the OnRemap handler.
+func Move(list string, _id string, after int) (n int, err error) {
+	mapping := map[int]int{}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, elB, err := listBuckets(tx, list)
+		if err != nil {
+			return err
+		}
+		id := []byte(_id)
+		seqBytes, err := common.GetEncodedSeqByID(list, id, b)
+		if err != nil {
+			return err
+		}
+		seq := common.BytesToSeq(seqBytes)
+		anchor := common.IntToUint(after)
+		if elB.Get(common.SeqToBytes(anchor)) == nil {
+			return common.ErrNotFound
+		}
+		if seq == anchor || seq == anchor+1 {
+			n = int(seq - common.ZeroPoint)
+			return nil
+		}
+		to, err := makeRoomAfter(list, b, elB, anchor, mapping)
+		if err != nil {
+			return err
+		}
+		// element could be shifted while making room, so it's sequence must be taken again
+		seqBytes, err = common.GetEncodedSeqByID(list, id, b)
+		if err != nil {
+			return err
+		}
+		err = moveElement(list, b, elB, append([]byte(nil), seqBytes...), common.SeqToBytes(to))
+		if err != nil {
+			return err
+		}
+		// position of the moved element is returned to the caller
+		delete(mapping, int(seq-common.ZeroPoint))
+		n = int(to - common.ZeroPoint)
+		return nil
+	})
+	if err == nil {
+		notifyRemap(list, mapping)
+	}
+	return n, err
+}
+
+// MoveToBack moves element with provided _id property to the back of the list and returns it's new sequence number
+func MoveToBack(list string, _id string) (n int, err error) {
+	return moveToEdge(list, _id, false)
+}
+
+// MoveToFront moves element with provided _id property to the front of the list and returns it's new sequence number
+func MoveToFront(list string, _id string) (n int, err error) {
+	return moveToEdge(list, _id, true)
+}
+
+func moveToEdge(list string, _id string, front bool) (n int, err error) {
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, elB, err := listBuckets(tx, list)
+		if err != nil {
+			return err
+		}
+		seqBytes, err := common.GetEncodedSeqByID(list, []byte(_id), b)
+		if err != nil {
+			return err
+		}
+		from := append([]byte(nil), seqBytes...)
+		var edge []byte
+		if front {
+			edge, _ = elB.Cursor().First()
+		} else {
+			edge, _ = elB.Cursor().Last()
+		}
+		if string(edge) == string(from) {
+			n = int(common.BytesToSeq(from) - common.ZeroPoint)
+			return nil
+		}
+		var seq uint64
+		if front {
+			seq, err = prevShiftedSequence(list, b)
+		} else {
+			seq, err = nextShiftedSequence(elB)
+		}
+		if err != nil {
+			return err
+		}
+		err = moveElement(list, b, elB, from, common.SeqToBytes(seq))
+		if err != nil {
+			return err
+		}
+		n = int(seq - common.ZeroPoint)
+		return nil
+	})
+	return n, err
+}
@@ -0,0 +1,50 @@
+package lists
+
+import (
+	"encoding/json"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/getblank/blank-queue/common"
+)
+
+// At returns element by it's ordinal index and it's sequence number.
+// Negative index counts elements from the back of the list, -1 is the last element.
+func At(list string, index int) (data interface{}, n int, err error) {
+	err = db.View(func(tx *bolt.Tx) error {
+		b, elB, err := listBuckets(tx, list)
+		if err != nil {
+			return err
+		}
+		if index < 0 {
+			index += int(totalCount(b, elB))
+			if index < 0 {
+				return errOutOfRange
+			}
+		}
+		k, v := seekIndex(b, elB, uint64(index))
+		if k == nil {
+			return errOutOfRange
+		}
+		n = int(common.BytesToSeq(k) - common.ZeroPoint)
+		return json.Unmarshal(v, &data)
+	})
+	return data, n, err
+}
+
+// Rank returns ordinal index of the element with provided _id property from the front of the list
+func Rank(list string, _id string) (index int, err error) {
+	err = db.View(func(tx *bolt.Tx) error {
+		b, elB, err := listBuckets(tx, list)
+		if err != nil {
+			return err
+		}
+		seqBytes, err := common.GetEncodedSeqByID(list, []byte(_id), b)
+		if err != nil {
+			return err
+		}
+		index = int(rank(b, elB, common.BytesToSeq(seqBytes)))
+		return nil
+	})
+	return index, err
+}
@@ -0,0 +1,278 @@
+package lists
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/boltdb/bolt"
+
+	"github.com/getblank/blank-queue/common"
+)
+
+// Partition periods
+const (
+	// PartitionHourly stores elements pushed within one hour in one partition
+	PartitionHourly = "hour"
+	// PartitionDaily stores elements pushed within one day in one partition
+	PartitionDaily = "day"
+)
+
+// partitionSweepInterval is the interval between drops of expired partitions
+const partitionSweepInterval = time.Minute
+
+// partitionsBucket stores partition sub-buckets keyed by the partition start unix time.
+// Elements in partitions are keyed by the sequence of the partitionsBucket.
+var partitionsBucket = []byte("_partitions")
+
+var (
+	errPartitionedList     = errors.New("operation is not supported by partitioned list")
+	errInvalidPartitioning = errors.New("invalid partitioning")
+)
+
+// Partitioning describes time-partitioned list. Elements are stored in partitions by the time they were pushed,
+// partitions which ended more than Retention periods ago are dropped. Zero Retention keeps partitions forever.
+type Partitioning struct {
+	Period    string `json:"period"`
+	Retention int    `json:"retention"`
+}
+
+// Partition describes one partition of the time-partitioned list
+type Partition struct {
+	Start time.Time `json:"start"`
+	Len   int       `json:"len"`
+}
+
+// CreatePartitioned creates time-partitioned list. Partitioned list supports only PushBack, Range, Len, Partitions
+// and Drop, other operations return error. Sequence numbers of the elements are increasing across partitions.
+func CreatePartitioned(list string, p *Partitioning) error {
+	if p == nil || p.Period != PartitionHourly && p.Period != PartitionDaily || p.Retention < 0 {
+		return errInvalidPartitioning
+	}
+	return db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(list)) != nil {
+			return common.ErrExists
+		}
+		b, err := tx.CreateBucket([]byte(list))
+		if err != nil {
+			return err
+		}
+		_, err = b.CreateBucket(partitionsBucket)
+		if err != nil {
+			return err
+		}
+		delete(lists, list)
+		stats, err := getStat(list, b)
+		if err != nil {
+			return err
+		}
+		stats.Partitioning = p
+		return saveStat(stats, b)
+	})
+}
+
+// Partitions returns partitions of the time-partitioned list from the oldest one
+func Partitions(list string) (partitions []*Partition, err error) {
+	partitions = []*Partition{}
+	err = db.View(func(tx *bolt.Tx) error {
+		pB := partitionsOf(tx, list)
+		if pB == nil {
+			return common.ErrNotFound
+		}
+		stats, err := readStat(tx.Bucket([]byte(list)))
+		if err != nil {
+			return err
+		}
+		for _, key := range partitionKeys(pB) {
+			start := int64(binary.BigEndian.Uint64(key))
+			partitions = append(partitions, &Partition{
+				Start: time.Unix(start, 0),
+				Len:   stats.PartitionLens[start],
+			})
+		}
+		return nil
+	})
+	return partitions, err
+}
+
+func (p *Partitioning) duration() time.Duration {
+	if p.Period == PartitionDaily {
+		return 24 * time.Hour
+	}
+	return time.Hour
+}
+
+// partitionsOf returns partitions bucket of the list or nil if list is not partitioned
+func partitionsOf(tx *bolt.Tx, list string) *bolt.Bucket {
+	b := tx.Bucket([]byte(list))
+	if b == nil {
+		return nil
+	}
+	return b.Bucket(partitionsBucket)
+}
+
+// partitionKeys returns keys of the partitions from the oldest one
+func partitionKeys(pB *bolt.Bucket) (keys [][]byte) {
+	c := pB.Cursor()
+	for k, v := c.First(); k != nil; k, v = c.Next() {
+		if v == nil {
+			keys = append(keys, append([]byte(nil), k...))
+		}
+	}
+	return keys
+}
+
+// partitionsLen returns number of elements in all partitions of the list
+func partitionsLen(stats *stat) (l uint64) {
+	for _, n := range stats.PartitionLens {
+		l += uint64(n)
+	}
+	return l
+}
+
+// pushPartitioned stores element to the partition of the current period and returns it's sequence number
+func pushPartitioned(list string, b *bolt.Bucket, data interface{}) (int, error) {
+	stats, err := getStat(list, b)
+	if err != nil {
+		return 0, err
+	}
+	if stats.Partitioning == nil {
+		return 0, errCurrupted
+	}
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return 0, err
+	}
+	pB := b.Bucket(partitionsBucket)
+	now := time.Now()
+	start := now.Truncate(stats.Partitioning.duration()).Unix()
+	key := uint64ToBytes(uint64(start))
+	partB := pB.Bucket(key)
+	if partB == nil {
+		partB, err = pB.CreateBucket(key)
+		if err != nil {
+			return 0, err
+		}
+		err = dropExpiredPartitions(b, pB, stats, now)
+		if err != nil {
+			return 0, err
+		}
+	}
+	seq, err := pB.NextSequence()
+	if err != nil {
+		return 0, err
+	}
+	err = partB.Put(uint64ToBytes(seq), encoded)
+	if err != nil {
+		return 0, err
+	}
+	if stats.PartitionLens == nil {
+		stats.PartitionLens = map[int64]int{}
+	}
+	stats.PartitionLens[start]++
+	err = saveStat(stats, b)
+	if err != nil {
+		return 0, err
+	}
+	return int(seq), nil
+}
+
+// rangePartitions works like Range for the partitioned list
+func rangePartitions(pB *bolt.Bucket, from *int, limit int, reverse bool) (items []*Item, next *int, err error) {
+	items = []*Item{}
+	keys := partitionKeys(pB)
+	if reverse {
+		for i, j := 0, len(keys)-1; i < j; i, j = i+1, j-1 {
+			keys[i], keys[j] = keys[j], keys[i]
+		}
+	}
+	for _, key := range keys {
+		c := pB.Bucket(key).Cursor()
+		var k, v []byte
+		switch {
+		case from == nil && reverse:
+			k, v = c.Last()
+		case from == nil:
+			k, v = c.First()
+		default:
+			var seqBytes []byte
+			if *from > 0 {
+				seqBytes = uint64ToBytes(uint64(*from))
+			} else {
+				seqBytes = uint64ToBytes(0)
+			}
+			k, v = c.Seek(seqBytes)
+			if reverse {
+				if k == nil {
+					k, v = c.Last()
+				} else if !bytes.Equal(k, seqBytes) {
+					k, v = c.Prev()
+				}
+			}
+		}
+		for ; k != nil; k, v = step(c, reverse) {
+			n := int(binary.BigEndian.Uint64(k))
+			if len(items) == limit {
+				return items, &n, nil
+			}
+			item := &Item{Position: n}
+			err = json.Unmarshal(v, &item.Element)
+			if err != nil {
+				return nil, nil, err
+			}
+			items = append(items, item)
+		}
+	}
+	return items, nil, nil
+}
+
+// dropExpiredPartitions drops partitions which ended more than retention periods before now
+func dropExpiredPartitions(b, pB *bolt.Bucket, stats *stat, now time.Time) error {
+	p := stats.Partitioning
+	if p.Retention == 0 {
+		return nil
+	}
+	cutoff := now.Add(-time.Duration(p.Retention) * p.duration())
+	var dropped bool
+	for _, key := range partitionKeys(pB) {
+		start := int64(binary.BigEndian.Uint64(key))
+		if time.Unix(start, 0).Add(p.duration()).After(cutoff) {
+			break
+		}
+		err := pB.DeleteBucket(key)
+		if err != nil {
+			return err
+		}
+		delete(stats.PartitionLens, start)
+		dropped = true
+	}
+	if !dropped {
+		return nil
+	}
+	return saveStat(stats, b)
+}
+
+// sweepPartitions periodically drops expired partitions of all partitioned lists
+func sweepPartitions() {
+	for range time.Tick(partitionSweepInterval) {
+		err := db.Update(func(tx *bolt.Tx) error {
+			return tx.ForEach(func(name []byte, b *bolt.Bucket) error {
+				pB := b.Bucket(partitionsBucket)
+				if pB == nil {
+					return nil
+				}
+				stats, err := getStat(string(name), b)
+				if err != nil || stats.Partitioning == nil {
+					return err
+				}
+				return dropExpiredPartitions(b, pB, stats, time.Now())
+			})
+		})
+		if err != nil {
+			log.WithError(err).Error("Can't drop expired list partitions")
+		}
+	}
+}
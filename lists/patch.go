@@ -0,0 +1,144 @@
+package lists
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/getblank/blank-queue/common"
+)
+
+// Field operations
+const (
+	// OpInc increments numeric field by Value, missing field is treated as zero
+	OpInc = "inc"
+	// OpPush appends Value to the array field, missing field is treated as empty array
+	OpPush = "push"
+	// OpSetIfAbsent sets field to the Value if field is missing
+	OpSetIfAbsent = "setIfAbsent"
+)
+
+var (
+	errIDChanged        = errors.New("_id can't be changed")
+	errInvalidOperation = errors.New("invalid operation")
+)
+
+// FieldOp is an atomic operation on the element field. Field is a dot separated path to the property.
+type FieldOp struct {
+	Op    string      `json:"op"`
+	Field string      `json:"field"`
+	Value interface{} `json:"value"`
+}
+
+// PatchByID applies JSON merge patch (RFC 7396) to the element with provided _id property and returns updated element
+func PatchByID(list, _id string, patch interface{}) (interface{}, error) {
+	return modifyByID(list, _id, func(data interface{}) (interface{}, error) {
+		return mergePatch(data, patch), nil
+	})
+}
+
+// ModifyByID applies field operations to the element with provided _id property and returns updated element.
+// All operations are applied atomically, element is not changed if any operation fails.
+func ModifyByID(list, _id string, ops []*FieldOp) (interface{}, error) {
+	return modifyByID(list, _id, func(data interface{}) (interface{}, error) {
+		m, ok := data.(map[string]interface{})
+		if !ok {
+			return nil, errInvalidOperation
+		}
+		for _, op := range ops {
+			if err := op.apply(m); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	})
+}
+
+func (op *FieldOp) apply(data map[string]interface{}) error {
+	if op == nil || op.Field == "" {
+		return errInvalidOperation
+	}
+	current, exists := common.GetField(data, op.Field)
+	switch op.Op {
+	case OpInc:
+		delta, ok := common.ToFloat(op.Value)
+		if !ok {
+			return errInvalidOperation
+		}
+		var n float64
+		if exists {
+			if n, ok = common.ToFloat(current); !ok {
+				return errInvalidOperation
+			}
+		}
+		common.SetField(data, op.Field, n+delta)
+	case OpPush:
+		var arr []interface{}
+		if exists {
+			var ok bool
+			if arr, ok = current.([]interface{}); !ok {
+				return errInvalidOperation
+			}
+		}
+		common.SetField(data, op.Field, append(arr, op.Value))
+	case OpSetIfAbsent:
+		if !exists {
+			common.SetField(data, op.Field, op.Value)
+		}
+	default:
+		return errInvalidOperation
+	}
+	return nil
+}
+
+// modifyByID reads element with provided _id, passes it to the fn and stores the result in one transaction
+func modifyByID(list, _id string, fn func(data interface{}) (interface{}, error)) (data interface{}, err error) {
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, elB, err := listBuckets(tx, list)
+		if err != nil {
+			return err
+		}
+		seqBytes, err := common.GetEncodedSeqByID(list, []byte(_id), b)
+		if err != nil {
+			return err
+		}
+		var current interface{}
+		err = json.Unmarshal(elB.Get(seqBytes), &current)
+		if err != nil {
+			return err
+		}
+		data, err = fn(current)
+		if err != nil {
+			return err
+		}
+		if id, ok := common.ExtractID(data); !ok || id != _id {
+			return errIDChanged
+		}
+		return putElement(list, b, elB, seqBytes, data)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// mergePatch applies JSON merge patch to the target as described in RFC 7396
+func mergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = map[string]interface{}{}
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+			continue
+		}
+		t[k] = mergePatch(t[k], v)
+	}
+	return t
+}
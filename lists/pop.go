@@ -0,0 +1,84 @@
+package lists
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/getblank/blank-queue/common"
+)
+
+// pushNotifier wakes up blocked pop calls when elements are added to the list
+var pushNotifier = common.NewNotifier()
+
+// PopBack removes and returns last element and it's sequence number
+// Returns error if list is empty
+func PopBack(list string) (data interface{}, n int, err error) {
+	return pop(list, false)
+}
+
+// PopBackWait removes and returns last element and it's sequence number.
+// If list is empty it waits for the new element until timeout is reached.
+func PopBackWait(list string, timeout time.Duration) (data interface{}, n int, err error) {
+	return popWait(list, false, timeout)
+}
+
+// PopFront removes and returns first element and it's sequence number
+// Returns error if list is empty
+func PopFront(list string) (data interface{}, n int, err error) {
+	return pop(list, true)
+}
+
+// PopFrontWait removes and returns first element and it's sequence number.
+// If list is empty it waits for the new element until timeout is reached.
+func PopFrontWait(list string, timeout time.Duration) (data interface{}, n int, err error) {
+	return popWait(list, true, timeout)
+}
+
+func pop(list string, front bool) (data interface{}, n int, err error) {
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, elB, err := listBuckets(tx, list)
+		if err == common.ErrNotFound {
+			return errListIsEmpty
+		}
+		if err != nil {
+			return err
+		}
+		var k, v []byte
+		if front {
+			k, v = elB.Cursor().First()
+		} else {
+			k, v = elB.Cursor().Last()
+		}
+		if k == nil {
+			return errListIsEmpty
+		}
+		err = json.Unmarshal(v, &data)
+		if err != nil {
+			return err
+		}
+		n = int(common.BytesToSeq(k) - common.ZeroPoint)
+		return deleteElement(list, b, elB, append([]byte(nil), k...))
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return data, n, nil
+}
+
+func popWait(list string, front bool, timeout time.Duration) (data interface{}, n int, err error) {
+	deadline := time.After(timeout)
+	for {
+		pushed := pushNotifier.Wait(list)
+		data, n, err = pop(list, front)
+		if err != errListIsEmpty {
+			return data, n, err
+		}
+		select {
+		case <-pushed:
+		case <-deadline:
+			return nil, 0, errListIsEmpty
+		}
+	}
+}
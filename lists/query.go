@@ -0,0 +1,101 @@
+package lists
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/getblank/blank-queue/common"
+)
+
+// Query returns elements matching the filter (see common.Match) in one read transaction.
+// sortBy is a dot separated path to the property to sort by, prefixed with "-" for descending order.
+// Numbers are ordered before strings, elements without the property or with other values are placed last.
+// If sortBy is empty, elements are returned in the list order. If fields are provided, only these properties are returned.
+// Zero limit means no limit.
+func Query(list string, filter map[string]interface{}, sortBy string, fields []string, limit int) (items []*Item, err error) {
+	if limit < 0 {
+		return nil, errInvalidLimit
+	}
+	err = common.ValidateFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+	items = []*Item{}
+	err = db.View(func(tx *bolt.Tx) error {
+		elB, err := elementsBucket(tx, list)
+		if err != nil {
+			return err
+		}
+		c := elB.Cursor()
+		for k, v := c.First(); k != nil; k, v = c.Next() {
+			if limit > 0 && sortBy == "" && len(items) == limit {
+				break
+			}
+			var data interface{}
+			err := json.Unmarshal(v, &data)
+			if err != nil {
+				return err
+			}
+			ok, err := common.Match(data, filter)
+			if err != nil {
+				return err
+			}
+			if ok {
+				items = append(items, &Item{Element: data, Position: int(common.BytesToSeq(k) - common.ZeroPoint)})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if sortBy != "" {
+		sortItems(items, sortBy)
+	}
+	if limit > 0 && len(items) > limit {
+		items = items[:limit]
+	}
+	if len(fields) > 0 {
+		for _, item := range items {
+			item.Element = common.Project(item.Element, fields)
+		}
+	}
+	return items, nil
+}
+
+// sortItems sorts items by the property, keeping list order for equal values.
+// Numbers are placed before strings, other values are placed last.
+func sortItems(items []*Item, sortBy string) {
+	desc := sortBy[0] == '-'
+	if desc {
+		sortBy = sortBy[1:]
+	}
+	sort.SliceStable(items, func(i, j int) bool {
+		a, _ := common.GetField(items[i].Element, sortBy)
+		b, _ := common.GetField(items[j].Element, sortBy)
+		aRank, bRank := sortRank(a), sortRank(b)
+		if aRank != bRank {
+			return aRank < bRank
+		}
+		res, ok := common.Compare(a, b)
+		if !ok {
+			return false
+		}
+		if desc {
+			return res > 0
+		}
+		return res < 0
+	})
+}
+
+func sortRank(v interface{}) int {
+	if _, ok := common.ToFloat(v); ok {
+		return 0
+	}
+	if _, ok := v.(string); ok {
+		return 1
+	}
+	return 2
+}
@@ -0,0 +1,102 @@
+package lists
+
+import (
+	"encoding/json"
+	"math/rand"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/getblank/blank-queue/common"
+)
+
+// Random returns up to n distinct random elements of the list.
+// Elements are picked by their ordinal indexes using block counters, so the list is not scanned.
+func Random(list string, n int) (items []*Item, err error) {
+	if n <= 0 {
+		return nil, errInvalidLimit
+	}
+	items = []*Item{}
+	err = db.View(func(tx *bolt.Tx) error {
+		b, elB, err := listBuckets(tx, list)
+		if err != nil {
+			return err
+		}
+		for _, index := range randomIndexes(int(totalCount(b, elB)), n) {
+			k, v := seekIndex(b, elB, uint64(index))
+			if k == nil {
+				return errCurrupted
+			}
+			item := &Item{Position: int(common.BytesToSeq(k) - common.ZeroPoint)}
+			err = json.Unmarshal(v, &item.Element)
+			if err != nil {
+				return err
+			}
+			items = append(items, item)
+		}
+		return nil
+	})
+	return items, err
+}
+
+// RandomWeighted returns up to n distinct random elements of the list, the probability to be picked is proportional
+// to the numeric value of the weight field. Elements without positive weight are never picked.
+// Weight field must be set by SetWeightField, elements are picked by per-block weight sums, so for every picked element
+// only one block of the list is read.
+func RandomWeighted(list string, n int, weightField string) (items []*Item, err error) {
+	if n <= 0 {
+		return nil, errInvalidLimit
+	}
+	items = []*Item{}
+	err = db.View(func(tx *bolt.Tx) error {
+		b, elB, err := listBuckets(tx, list)
+		if err != nil {
+			return err
+		}
+		stats, err := readStat(b)
+		if err != nil {
+			return err
+		}
+		if weightField == "" || stats.WeightField != weightField {
+			return errNoWeightField
+		}
+		wb := b.Bucket(weightsBucket)
+		if wb == nil {
+			return nil
+		}
+		s := newWeightedSampler(elB, wb, weightField)
+		for len(items) < n && s.total > 0 {
+			k, v, ok := s.pick(rand.Float64() * s.total)
+			if !ok {
+				continue
+			}
+			item := &Item{Position: int(common.BytesToSeq(k) - common.ZeroPoint)}
+			err = json.Unmarshal(v, &item.Element)
+			if err != nil {
+				return err
+			}
+			items = append(items, item)
+		}
+		return nil
+	})
+	return items, err
+}
+
+// randomIndexes returns up to n distinct random numbers in [0, total)
+func randomIndexes(total, n int) []int {
+	if n >= total {
+		return rand.Perm(total)
+	}
+	if n*2 >= total {
+		return rand.Perm(total)[:n]
+	}
+	picked := make(map[int]bool, n)
+	res := make([]int, 0, n)
+	for len(res) < n {
+		i := rand.Intn(total)
+		if !picked[i] {
+			picked[i] = true
+			res = append(res, i)
+		}
+	}
+	return res
+}
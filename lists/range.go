@@ -0,0 +1,146 @@
+package lists
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/getblank/blank-queue/common"
+)
+
+var errInvalidLimit = errors.New("invalid limit")
+
+// Item is a list element with it's sequence number
+type Item struct {
+	Element  interface{} `json:"element"`
+	Position int         `json:"position"`
+}
+
+// Range returns up to limit elements starting from the provided sequence number inclusive.
+// If from is nil, elements are returned from the front of the list, or from the back if reverse is true.
+// Returns sequence number of the element to continue from, or nil if there are no more elements.
+func Range(list string, from *int, limit int, reverse bool) (items []*Item, next *int, err error) {
+	if limit <= 0 {
+		return nil, nil, errInvalidLimit
+	}
+	items = []*Item{}
+	err = db.View(func(tx *bolt.Tx) error {
+		if pB := partitionsOf(tx, list); pB != nil {
+			items, next, err = rangePartitions(pB, from, limit, reverse)
+			return err
+		}
+		elB, err := elementsBucket(tx, list)
+		if err != nil {
+			return err
+		}
+		c := elB.Cursor()
+		var k, v []byte
+		switch {
+		case from == nil && reverse:
+			k, v = c.Last()
+		case from == nil:
+			k, v = c.First()
+		default:
+			seqBytes := common.SeqToBytes(common.IntToUint(*from))
+			k, v = c.Seek(seqBytes)
+			if reverse {
+				if k == nil {
+					k, v = c.Last()
+				} else if common.BytesToSeq(k) > common.BytesToSeq(seqBytes) {
+					k, v = c.Prev()
+				}
+			}
+		}
+		items, next, err = collect(c, k, v, limit, reverse)
+		return err
+	})
+	return items, next, err
+}
+
+// Slice returns up to limit elements starting from the offset element from the front of the list
+func Slice(list string, offset, limit int) (items []*Item, err error) {
+	if limit <= 0 || offset < 0 {
+		return nil, errInvalidLimit
+	}
+	items = []*Item{}
+	err = db.View(func(tx *bolt.Tx) error {
+		b, elB, err := listBuckets(tx, list)
+		if err != nil {
+			return err
+		}
+		c := elB.Cursor()
+		k, _ := seekIndex(b, elB, uint64(offset))
+		if k == nil {
+			return nil
+		}
+		k, v := c.Seek(k)
+		items, _, err = collect(c, k, v, limit, false)
+		return err
+	})
+	return items, err
+}
+
+// collect reads up to limit elements from the cursor current position and returns sequence number of the next element
+func collect(c *bolt.Cursor, k, v []byte, limit int, reverse bool) (items []*Item, next *int, err error) {
+	items = []*Item{}
+	for ; k != nil; k, v = step(c, reverse) {
+		n := int(common.BytesToSeq(k) - common.ZeroPoint)
+		if len(items) == limit {
+			next = &n
+			break
+		}
+		item := &Item{Position: n}
+		err = json.Unmarshal(v, &item.Element)
+		if err != nil {
+			return nil, nil, err
+		}
+		items = append(items, item)
+	}
+	return items, next, nil
+}
+
+func step(c *bolt.Cursor, reverse bool) ([]byte, []byte) {
+	if reverse {
+		return c.Prev()
+	}
+	return c.Next()
+}
+
+// elementsBucket returns elements bucket of the list
+func elementsBucket(tx *bolt.Tx, list string) (*bolt.Bucket, error) {
+	_, elB, err := listBuckets(tx, list)
+	return elB, err
+}
+
+// listBuckets returns list bucket and it's elements bucket
+func listBuckets(tx *bolt.Tx, list string) (b, elB *bolt.Bucket, err error) {
+	b = tx.Bucket([]byte(list))
+	if b == nil {
+		return nil, nil, common.ErrNotFound
+	}
+	elB = b.Bucket(common.ElementsBucket)
+	if elB == nil {
+		if b.Bucket(partitionsBucket) != nil {
+			return nil, nil, errPartitionedList
+		}
+		return nil, nil, common.ErrNotFound
+	}
+	return b, elB, nil
+}
+
+// createListBuckets returns list bucket and it's elements bucket creating them if they are not exist
+func createListBuckets(tx *bolt.Tx, list string) (b, elB *bolt.Bucket, err error) {
+	b, err = tx.CreateBucketIfNotExists([]byte(list))
+	if err != nil {
+		return nil, nil, err
+	}
+	if b.Bucket(partitionsBucket) != nil {
+		return nil, nil, errPartitionedList
+	}
+	elB, err = b.CreateBucketIfNotExists(common.ElementsBucket)
+	if err != nil {
+		return nil, nil, err
+	}
+	return b, elB, nil
+}
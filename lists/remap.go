@@ -0,0 +1,17 @@
+package lists
+
+// remapHandler receives positions of the elements shifted by the list operations
+var remapHandler func(list string, mapping map[int]int)
+
+// OnRemap sets handler which is called after the operation changed positions of the existing elements,
+// e.g. when neighbours are shifted to make room for the inserted element or when the list is compacted.
+// Mapping is from the old sequence numbers to the new ones. Handler must be set before the lists are used.
+func OnRemap(handler func(list string, mapping map[int]int)) {
+	remapHandler = handler
+}
+
+func notifyRemap(list string, mapping map[int]int) {
+	if remapHandler != nil && len(mapping) > 0 {
+		remapHandler(list, mapping)
+	}
+}
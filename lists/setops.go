@@ -0,0 +1,127 @@
+package lists
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/getblank/blank-queue/common"
+)
+
+var errNoLists = errors.New("no lists provided")
+
+// Diff returns elements of the first list whose _id is not present in any of the other lists.
+// If dest is not empty, result replaces contents of the dest list in the same transaction.
+func Diff(names []string, dest string) ([]interface{}, error) {
+	return setOperation(names, dest, func(tx *bolt.Tx) ([]interface{}, error) {
+		return filterByID(tx, names, func(found int) bool { return found == 0 })
+	})
+}
+
+// Intersect returns elements of the first list whose _id is present in all of the other lists.
+// If dest is not empty, result replaces contents of the dest list in the same transaction.
+func Intersect(names []string, dest string) ([]interface{}, error) {
+	return setOperation(names, dest, func(tx *bolt.Tx) ([]interface{}, error) {
+		return filterByID(tx, names, func(found int) bool { return found == len(names)-1 })
+	})
+}
+
+// Union returns elements of all lists with distinct _id, element from the first list containing the _id wins.
+// Elements are ordered as in the lists, lists are taken in the passed order.
+// If dest is not empty, result replaces contents of the dest list in the same transaction.
+func Union(names []string, dest string) ([]interface{}, error) {
+	return setOperation(names, dest, func(tx *bolt.Tx) ([]interface{}, error) {
+		res := []interface{}{}
+		seen := map[string]bool{}
+		for _, list := range names {
+			err := forEachWithID(tx, list, func(_id string, data interface{}) {
+				if !seen[_id] {
+					seen[_id] = true
+					res = append(res, data)
+				}
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+		return res, nil
+	})
+}
+
+// setOperation calculates result in the read transaction, or in the write one if result should be stored to the dest list
+func setOperation(names []string, dest string, calc func(tx *bolt.Tx) ([]interface{}, error)) (res []interface{}, err error) {
+	if len(names) == 0 {
+		return nil, errNoLists
+	}
+	if dest == "" {
+		err = db.View(func(tx *bolt.Tx) error {
+			res, err = calc(tx)
+			return err
+		})
+		return res, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		res, err = calc(tx)
+		if err != nil {
+			return err
+		}
+		return replaceAll(tx, dest, res)
+	})
+	if err == nil && len(res) > 0 {
+		pushNotifier.Notify(dest)
+	}
+	return res, err
+}
+
+// filterByID returns elements of the first list accepted by the number of other lists containing the element _id
+func filterByID(tx *bolt.Tx, names []string, accept func(found int) bool) ([]interface{}, error) {
+	var others []*bolt.Bucket
+	for _, list := range names[1:] {
+		b, _, err := listBuckets(tx, list)
+		if err == common.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if ib := b.Bucket(common.IDToSeqBucket); ib != nil {
+			others = append(others, ib)
+		}
+	}
+	res := []interface{}{}
+	err := forEachWithID(tx, names[0], func(_id string, data interface{}) {
+		found := 0
+		for _, ib := range others {
+			if ib.Get([]byte(_id)) != nil {
+				found++
+			}
+		}
+		if accept(found) {
+			res = append(res, data)
+		}
+	})
+	return res, err
+}
+
+// forEachWithID calls fn for every list element having _id property. Not existing list is treated as empty.
+func forEachWithID(tx *bolt.Tx, list string, fn func(_id string, data interface{})) error {
+	elB, err := elementsBucket(tx, list)
+	if err == common.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return elB.ForEach(func(_, v []byte) error {
+		var data interface{}
+		err := json.Unmarshal(v, &data)
+		if err != nil {
+			return err
+		}
+		if _id, ok := common.ExtractID(data); ok {
+			fn(_id, data)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,314 @@
+package lists
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/boltdb/bolt"
+
+	"github.com/getblank/blank-queue/common"
+)
+
+const (
+	// trashRetention is the default time removed elements are kept in the trash
+	trashRetention = 7 * 24 * time.Hour
+	// trashSweepInterval is the interval between trash purges
+	trashSweepInterval = time.Minute
+	// purgeBatchSize is the max number of the removed elements purged from the list in one transaction
+	purgeBatchSize = 1000
+)
+
+var (
+	// trashBucket stores softly removed elements by their _id
+	trashBucket = []byte("_trash")
+	// trashDeletedBucket stores _id of the elements in the trash keyed by removal time and _id, see deletedKey
+	trashDeletedBucket = []byte("_trashDeleted")
+)
+
+var errInvalidTrashRetention = errors.New("invalid trash retention")
+
+// TrashItem is the softly removed element with it's original sequence number and deletion time
+type TrashItem struct {
+	Element   json.RawMessage `json:"element"`
+	Position  int             `json:"position"`
+	DeletedAt time.Time       `json:"deletedAt"`
+}
+
+// Restore puts softly removed element with provided _id property back to the list and returns it's sequence number.
+// Element is restored to it's original position if it is free and the list was not compacted after the element removal,
+// otherwise it is added to the back of the list.
+// List cap is applied as on push, element stays in the trash if it would be evicted by the cap.
+func Restore(list string, _id string) (n int, err error) {
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, elB, err := listBuckets(tx, list)
+		if err != nil {
+			return err
+		}
+		tB := b.Bucket(trashBucket)
+		if tB == nil {
+			return common.ErrNotFound
+		}
+		v := tB.Get([]byte(_id))
+		if v == nil {
+			return common.ErrNotFound
+		}
+		if _, err := common.GetEncodedSeqByID(list, []byte(_id), b); err == nil {
+			return common.ErrExists
+		}
+		var item TrashItem
+		err = json.Unmarshal(v, &item)
+		if err != nil {
+			return err
+		}
+		var data interface{}
+		err = json.Unmarshal(item.Element, &data)
+		if err != nil {
+			return err
+		}
+		err = tB.Delete([]byte(_id))
+		if err != nil {
+			return err
+		}
+		if dB := b.Bucket(trashDeletedBucket); dB != nil {
+			err = dB.Delete(deletedKey(item.DeletedAt, []byte(_id)))
+			if err != nil {
+				return err
+			}
+		}
+		stats, err := getStat(list, b)
+		if err != nil {
+			return err
+		}
+		seqBytes := common.SeqToBytes(common.IntToUint(item.Position))
+		if elB.Get(seqBytes) != nil || !item.DeletedAt.After(stats.CompactedAt) {
+			n, err = pushBack(list, b, elB, data)
+			if err != nil {
+				return err
+			}
+			seqBytes = common.SeqToBytes(common.IntToUint(n))
+		} else {
+			n = item.Position
+			err = putElement(list, b, elB, seqBytes, data)
+			if err != nil {
+				return err
+			}
+		}
+		return enforceCap(list, b, elB, seqBytes)
+	})
+	if err == nil {
+		pushNotifier.Notify(list)
+	}
+	return n, err
+}
+
+// SoftRemove moves element with provided sequence number to the trash of the list
+// Element must have _id property to be restored later. Returns common.ErrExists if element with the same _id
+// is already in the trash.
+func SoftRemove(list string, n int) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		b, elB, err := listBuckets(tx, list)
+		if err != nil {
+			return err
+		}
+		return trash(list, b, elB, common.SeqToBytes(common.IntToUint(n)))
+	})
+}
+
+// SoftRemoveByID moves element with provided _id property to the trash of the list if it's version equals to the expected one.
+// Zero expected version disables the check.
+func SoftRemoveByID(list string, _id string, version uint64) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		b, elB, err := listBuckets(tx, list)
+		if err != nil {
+			return err
+		}
+		seqBytes, err := common.GetEncodedSeqByID(list, []byte(_id), b)
+		if err != nil {
+			return err
+		}
+		seqBytes = append([]byte(nil), seqBytes...)
+		err = checkVersion(b, seqBytes, version)
+		if err != nil {
+			return err
+		}
+		return trash(list, b, elB, seqBytes)
+	})
+}
+
+// SetTrashRetention sets the time softly removed elements of the list are kept in the trash.
+// Zero retention resets it to the default 7 days.
+func SetTrashRetention(list string, retention time.Duration) error {
+	if retention < 0 {
+		return errInvalidTrashRetention
+	}
+	return db.Update(func(tx *bolt.Tx) error {
+		b, _, err := listBuckets(tx, list)
+		if err != nil {
+			return err
+		}
+		stats, err := getStat(list, b)
+		if err != nil {
+			return err
+		}
+		stats.TrashRetention = retention
+		return saveStat(stats, b)
+	})
+}
+
+// Trash returns softly removed elements of the list ordered by _id
+func Trash(list string) (items []*TrashItem, err error) {
+	items = []*TrashItem{}
+	err = db.View(func(tx *bolt.Tx) error {
+		b, _, err := listBuckets(tx, list)
+		if err != nil {
+			return err
+		}
+		tB := b.Bucket(trashBucket)
+		if tB == nil {
+			return nil
+		}
+		return tB.ForEach(func(_, v []byte) error {
+			item := &TrashItem{}
+			err := json.Unmarshal(v, item)
+			if err != nil {
+				return err
+			}
+			items = append(items, item)
+			return nil
+		})
+	})
+	return items, err
+}
+
+// trash moves element to the trash bucket and removes it from the list
+func trash(list string, b, elB *bolt.Bucket, seqBytes []byte) error {
+	v := elB.Get(seqBytes)
+	if v == nil {
+		return common.ErrNotFound
+	}
+	var data interface{}
+	err := json.Unmarshal(v, &data)
+	if err != nil {
+		return err
+	}
+	_id, ok := common.ExtractID(data)
+	if !ok {
+		return common.ErrNoIDInTheElement
+	}
+	deletedAt := time.Now()
+	encoded, err := json.Marshal(&TrashItem{
+		Element:   append(json.RawMessage(nil), v...),
+		Position:  int(common.BytesToSeq(seqBytes) - common.ZeroPoint),
+		DeletedAt: deletedAt,
+	})
+	if err != nil {
+		return err
+	}
+	tB, err := b.CreateBucketIfNotExists(trashBucket)
+	if err != nil {
+		return err
+	}
+	if tB.Get([]byte(_id)) != nil {
+		return common.ErrExists
+	}
+	err = tB.Put([]byte(_id), encoded)
+	if err != nil {
+		return err
+	}
+	dB, err := b.CreateBucketIfNotExists(trashDeletedBucket)
+	if err != nil {
+		return err
+	}
+	err = dB.Put(deletedKey(deletedAt, []byte(_id)), nil)
+	if err != nil {
+		return err
+	}
+	return deleteElement(list, b, elB, seqBytes)
+}
+
+// purgeTrash removes elements kept longer than the trash retention of their list at the passed time from the trash of all lists.
+// History of the elements removed before the same time is purged too.
+// Every list is purged by the separate transactions of up to purgeBatchSize elements, so writers are not blocked for long.
+func purgeTrash(now time.Time) (purged int, err error) {
+	var names []string
+	err = db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+			names = append(names, string(name))
+			return nil
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+	for _, list := range names {
+		for {
+			n, more, err := purgeListTrash(list, now)
+			purged += n
+			if err != nil {
+				return purged, err
+			}
+			if !more {
+				break
+			}
+		}
+	}
+	return purged, nil
+}
+
+// purgeListTrash purges up to purgeBatchSize expired elements from the trash and the history of the list.
+// Returns number of the elements purged from the trash and true if there can be more expired elements.
+func purgeListTrash(list string, now time.Time) (purged int, more bool, err error) {
+	err = db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(list))
+		if b == nil {
+			return nil
+		}
+		tB := b.Bucket(trashBucket)
+		if tB == nil && b.Bucket(historyBucket) == nil {
+			return nil
+		}
+		stats, err := getStat(list, b)
+		if err != nil {
+			return err
+		}
+		retention := stats.TrashRetention
+		if retention == 0 {
+			retention = trashRetention
+		}
+		before := now.Add(-retention)
+		n, err := purgeHistory(b, before, purgeBatchSize)
+		if err != nil {
+			return err
+		}
+		more = n == purgeBatchSize
+		if tB == nil {
+			return nil
+		}
+		purged, err = purgeDeleted(b.Bucket(trashDeletedBucket), before, purgeBatchSize, tB.Delete)
+		if err != nil {
+			return err
+		}
+		more = more || purged == purgeBatchSize
+		return nil
+	})
+	if err != nil {
+		return 0, false, err
+	}
+	return purged, more, nil
+}
+
+// sweepTrash periodically purges elements kept in the trash longer than the list trash retention
+func sweepTrash() {
+	for range time.Tick(trashSweepInterval) {
+		purged, err := purgeTrash(time.Now())
+		if err != nil {
+			log.WithError(err).Error("Can't purge lists trash")
+			continue
+		}
+		if purged > 0 {
+			log.WithField("purged", purged).Debug("Lists trash purged")
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package lists
+
+import (
+	"errors"
+
+	"github.com/boltdb/bolt"
+)
+
+// Trim directions
+const (
+	// TrimFront removes elements from the front of the list
+	TrimFront = "front"
+	// TrimBack removes elements from the back of the list
+	TrimBack = "back"
+)
+
+var (
+	errInvalidCap   = errors.New("invalid cap")
+	errEvictedByCap = errors.New("element is evicted by the list cap")
+)
+
+// Cap describes max length of the list and the side from which elements are removed when list exceeds it
+type Cap struct {
+	MaxLen uint64 `json:"maxLen"`
+	From   string `json:"from"`
+}
+
+// SetCap sets max length of the list enforced on every push and trims the list to it.
+// Nil cap removes the limit. Returns number of removed elements.
+// Push which element is evicted right away by the cap, e.g. PushBack to the full list trimmed from the back,
+// is rejected with error and does not change the list.
+func SetCap(list string, listCap *Cap) (removed int, err error) {
+	if listCap != nil && (listCap.MaxLen == 0 || listCap.From != TrimFront && listCap.From != TrimBack) {
+		return 0, errInvalidCap
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, elB, err := createListBuckets(tx, list)
+		if err != nil {
+			return err
+		}
+		stats, err := getStat(list, b)
+		if err != nil {
+			return err
+		}
+		stats.Cap = listCap
+		err = saveStat(stats, b)
+		if err != nil {
+			return err
+		}
+		if listCap == nil {
+			return nil
+		}
+		removed, err = trim(list, b, elB, listCap.MaxLen, listCap.From)
+		return err
+	})
+	return removed, err
+}
+
+// Trim removes elements from the front or from the back of the list until it's length is not more than maxLen.
+// Returns number of removed elements.
+func Trim(list string, maxLen uint64, from string) (removed int, err error) {
+	if from != TrimFront && from != TrimBack {
+		return 0, errInvalidCap
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, elB, err := listBuckets(tx, list)
+		if err != nil {
+			return err
+		}
+		removed, err = trim(list, b, elB, maxLen, from)
+		return err
+	})
+	return removed, err
+}
+
+// enforceCap trims the list if it has a cap.
+// Returns error if the just pushed element with the seqBytes key was removed by trimming, nil seqBytes skips the check.
+func enforceCap(list string, b, elB *bolt.Bucket, seqBytes []byte) error {
+	stats, err := getStat(list, b)
+	if err != nil || stats.Cap == nil {
+		return err
+	}
+	_, err = trim(list, b, elB, stats.Cap.MaxLen, stats.Cap.From)
+	if err != nil {
+		return err
+	}
+	if seqBytes != nil && elB.Get(seqBytes) == nil {
+		return errEvictedByCap
+	}
+	return nil
+}
+
+func trim(list string, b, elB *bolt.Bucket, maxLen uint64, from string) (removed int, err error) {
+	l := totalCount(b, elB)
+	c := elB.Cursor()
+	for ; l > maxLen; l-- {
+		var k []byte
+		if from == TrimFront {
+			k, _ = c.First()
+		} else {
+			k, _ = c.Last()
+		}
+		if k == nil {
+			break
+		}
+		err = deleteElement(list, b, elB, append([]byte(nil), k...))
+		if err != nil {
+			return removed, err
+		}
+		removed++
+	}
+	return removed, nil
+}
@@ -0,0 +1,36 @@
+package lists
+
+import (
+	"encoding/json"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/getblank/blank-queue/common"
+)
+
+// UniqueError returns when element violates unique index of the list.
+// It names the field and the _id of the element already having the same value.
+// ID is empty if conflicting element has no _id property.
+type UniqueError struct {
+	Field string      `json:"field"`
+	Value interface{} `json:"value"`
+	ID    string      `json:"_id,omitempty"`
+}
+
+// Error returns JSON representation of the error, so clients can get the details from the RPC error message
+func (e *UniqueError) Error() string {
+	encoded, _ := json.Marshal(struct {
+		Error string `json:"error"`
+		*UniqueError
+	}{"unique constraint violation", e})
+	return string(encoded)
+}
+
+func newUniqueError(b *bolt.Bucket, field string, data interface{}, conflictSeq []byte) *UniqueError {
+	err := &UniqueError{Field: field}
+	err.Value, _ = common.GetField(data, field)
+	if sb := b.Bucket(common.SeqToIDBucket); sb != nil {
+		err.ID = string(sb.Get(conflictSeq))
+	}
+	return err
+}
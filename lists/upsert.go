@@ -0,0 +1,77 @@
+package lists
+
+import (
+	"github.com/boltdb/bolt"
+
+	"github.com/getblank/blank-queue/common"
+)
+
+// ReplaceAll atomically replaces all elements of the list with the passed ones.
+// List settings such as cap and indexes are kept. Returns common.ErrExists if passed elements have duplicated _id.
+func ReplaceAll(list string, elements []interface{}) error {
+	err := db.Update(func(tx *bolt.Tx) error {
+		return replaceAll(tx, list, elements)
+	})
+	if err == nil && len(elements) > 0 {
+		pushNotifier.Notify(list)
+	}
+	return err
+}
+
+// replaceAll replaces all elements of the list in the passed transaction
+func replaceAll(tx *bolt.Tx, list string, elements []interface{}) error {
+	b, elB, err := createListBuckets(tx, list)
+	if err != nil {
+		return err
+	}
+	var keys [][]byte
+	c := elB.Cursor()
+	for k, _ := c.First(); k != nil; k, _ = c.Next() {
+		keys = append(keys, append([]byte(nil), k...))
+	}
+	for _, k := range keys {
+		err = deleteElement(list, b, elB, k)
+		if err != nil {
+			return err
+		}
+	}
+	for _, data := range elements {
+		_, err = pushBack(list, b, elB, data)
+		if err != nil {
+			return err
+		}
+	}
+	return enforceCap(list, b, elB, nil)
+}
+
+// UpsertByID updates element by provided _id property of the passed element keeping it's position
+// or adds element to the back of the list if it was not found.
+// Returns position of the element and true if element was inserted.
+func UpsertByID(list string, data interface{}) (n int, inserted bool, err error) {
+	_id, ok := common.ExtractID(data)
+	if !ok {
+		return 0, false, common.ErrNoIDInTheElement
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, elB, err := createListBuckets(tx, list)
+		if err != nil {
+			return err
+		}
+		seqBytes, err := common.GetEncodedSeqByID(list, []byte(_id), b)
+		if err == nil {
+			seqBytes = append([]byte(nil), seqBytes...)
+			n = int(common.BytesToSeq(seqBytes) - common.ZeroPoint)
+			return putElement(list, b, elB, seqBytes, data)
+		}
+		n, err = pushBack(list, b, elB, data)
+		if err != nil {
+			return err
+		}
+		inserted = true
+		return enforceCap(list, b, elB, common.SeqToBytes(uint64(n)+common.ZeroPoint))
+	})
+	if err == nil && inserted {
+		pushNotifier.Notify(list)
+	}
+	return n, inserted, err
+}
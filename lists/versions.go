@@ -0,0 +1,168 @@
+package lists
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/getblank/blank-queue/common"
+)
+
+// versionsBucket stores element versions by the sequence. Versions are taken from the bucket sequence,
+// so they are increasing monotonically across the whole list and never reused.
+var versionsBucket = []byte("_versions")
+
+var errVersionConflict = errors.New("version conflict")
+
+// GetByIDWithVersion returns element by provided _id property, it's position and version
+func GetByIDWithVersion(list string, _id string) (data interface{}, n int, version uint64, err error) {
+	err = db.View(func(tx *bolt.Tx) error {
+		b, elB, err := listBuckets(tx, list)
+		if err != nil {
+			return err
+		}
+		seqBytes, err := common.GetEncodedSeqByID(list, []byte(_id), b)
+		if err != nil {
+			return err
+		}
+		v := elB.Get(seqBytes)
+		if v == nil {
+			return common.ErrNotFound
+		}
+		n = int(common.BytesToSeq(seqBytes) - common.ZeroPoint)
+		version = getVersion(b, seqBytes)
+		return json.Unmarshal(v, &data)
+	})
+	return
+}
+
+// GetWithVersion returns element by the position and it's version
+func GetWithVersion(list string, n int) (data interface{}, version uint64, err error) {
+	err = db.View(func(tx *bolt.Tx) error {
+		b, elB, err := listBuckets(tx, list)
+		if err != nil {
+			return err
+		}
+		seqBytes := common.SeqToBytes(uint64(n) + common.ZeroPoint)
+		v := elB.Get(seqBytes)
+		if v == nil {
+			return common.ErrNotFound
+		}
+		version = getVersion(b, seqBytes)
+		return json.Unmarshal(v, &data)
+	})
+	return
+}
+
+// RemoveByIDIfVersion removes element by provided _id property if it's version equals to the expected one.
+// Zero expected version disables the check.
+func RemoveByIDIfVersion(list string, _id string, version uint64) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		b, elB, err := listBuckets(tx, list)
+		if err != nil {
+			return err
+		}
+		seqBytes, err := common.GetEncodedSeqByID(list, []byte(_id), b)
+		if err != nil {
+			return err
+		}
+		err = checkVersion(b, seqBytes, version)
+		if err != nil {
+			return err
+		}
+		return deleteElement(list, b, elB, seqBytes)
+	})
+}
+
+// UpdateByIDIfVersion updates element by provided _id property of the passed element if it's version equals
+// to the expected one and returns the new version. Zero expected version disables the check.
+func UpdateByIDIfVersion(list string, data interface{}, version uint64) (newVersion uint64, err error) {
+	_id, ok := common.ExtractID(data)
+	if !ok {
+		return 0, common.ErrNoIDInTheElement
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, elB, err := listBuckets(tx, list)
+		if err != nil {
+			return err
+		}
+		seqBytes, err := common.GetEncodedSeqByID(list, []byte(_id), b)
+		if err != nil {
+			return err
+		}
+		err = checkVersion(b, seqBytes, version)
+		if err != nil {
+			return err
+		}
+		err = putElement(list, b, elB, seqBytes, data)
+		if err != nil {
+			return err
+		}
+		newVersion = getVersion(b, seqBytes)
+		return nil
+	})
+	return
+}
+
+// checkVersion returns errVersionConflict if element version is not equal to the expected one
+func checkVersion(b *bolt.Bucket, seqBytes []byte, expected uint64) error {
+	if expected != 0 && getVersion(b, seqBytes) != expected {
+		return errVersionConflict
+	}
+	return nil
+}
+
+// getVersion returns stored element version, elements stored before versioning was introduced have zero version
+func getVersion(b *bolt.Bucket, seqBytes []byte) uint64 {
+	vB := b.Bucket(versionsBucket)
+	if vB == nil {
+		return 0
+	}
+	v := vB.Get(seqBytes)
+	if v == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(v)
+}
+
+// nextVersion assigns new version to the element
+func nextVersion(b *bolt.Bucket, seqBytes []byte) error {
+	vB, err := b.CreateBucketIfNotExists(versionsBucket)
+	if err != nil {
+		return err
+	}
+	version, err := vB.NextSequence()
+	if err != nil {
+		return err
+	}
+	return vB.Put(seqBytes, uint64ToBytes(version))
+}
+
+// deleteVersion removes element version record
+func deleteVersion(b *bolt.Bucket, seqBytes []byte) error {
+	vB := b.Bucket(versionsBucket)
+	if vB == nil {
+		return nil
+	}
+	return vB.Delete(seqBytes)
+}
+
+// moveVersion moves version record to the new sequence, element content is not changed so version is kept
+func moveVersion(b *bolt.Bucket, from, to []byte) error {
+	vB := b.Bucket(versionsBucket)
+	if vB == nil {
+		return nil
+	}
+	v := vB.Get(from)
+	if v == nil {
+		return vB.Delete(to)
+	}
+	version := append([]byte(nil), v...)
+	err := vB.Delete(from)
+	if err != nil {
+		return err
+	}
+	return vB.Put(to, version)
+}
@@ -0,0 +1,185 @@
+package lists
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/getblank/blank-queue/common"
+)
+
+// weightsBucket stores sum of the weight field values of the elements for each block of sequences
+var weightsBucket = []byte("_weights")
+
+var errNoWeightField = errors.New("weight field is not set for the list")
+
+// SetWeightField sets numeric property of the elements used by RandomWeighted and builds weight sums for it.
+// Empty field removes weight sums.
+func SetWeightField(list string, field string) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		b, elB, err := createListBuckets(tx, list)
+		if err != nil {
+			return err
+		}
+		stats, err := getStat(list, b)
+		if err != nil {
+			return err
+		}
+		stats.WeightField = field
+		err = saveStat(stats, b)
+		if err != nil {
+			return err
+		}
+		if b.Bucket(weightsBucket) != nil {
+			err = b.DeleteBucket(weightsBucket)
+			if err != nil {
+				return err
+			}
+		}
+		if field == "" {
+			return nil
+		}
+		wb, err := b.CreateBucket(weightsBucket)
+		if err != nil {
+			return err
+		}
+		sums := map[uint64]float64{}
+		err = elB.ForEach(func(k, v []byte) error {
+			sums[block(common.BytesToSeq(k))] += elementWeight(v, field)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		for bl, sum := range sums {
+			if sum <= 0 {
+				continue
+			}
+			err = wb.Put(uint64ToBytes(bl), weightToBytes(sum))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// addWeight adds weight of the encoded element to the sum of the block with passed sequence if the list has weight field.
+// Negative sign subtracts the weight.
+func addWeight(list string, b *bolt.Bucket, seq uint64, encoded []byte, sign float64) error {
+	stats, err := getStat(list, b)
+	if err != nil || stats.WeightField == "" {
+		return err
+	}
+	w := elementWeight(encoded, stats.WeightField)
+	if w == 0 {
+		return nil
+	}
+	wb, err := b.CreateBucketIfNotExists(weightsBucket)
+	if err != nil {
+		return err
+	}
+	key := uint64ToBytes(block(seq))
+	var sum float64
+	if v := wb.Get(key); v != nil {
+		sum = bytesToWeight(v)
+	}
+	sum += sign * w
+	if sum <= 0 {
+		return wb.Delete(key)
+	}
+	return wb.Put(key, weightToBytes(sum))
+}
+
+// weightedSampler picks distinct elements with probability proportional to their weights
+type weightedSampler struct {
+	elB, wb *bolt.Bucket
+	field   string
+	total   float64
+	picked  map[string]bool
+	removed map[uint64]float64
+}
+
+func newWeightedSampler(elB, wb *bolt.Bucket, field string) *weightedSampler {
+	s := &weightedSampler{elB: elB, wb: wb, field: field, picked: map[string]bool{}, removed: map[uint64]float64{}}
+	wb.ForEach(func(_, v []byte) error {
+		s.total += bytesToWeight(v)
+		return nil
+	})
+	return s
+}
+
+// pick returns element which is not picked yet at the weight offset r and excludes it from the following picks.
+// Only the block containing the offset is scanned. Returns false if nothing was picked, total is decreased anyway.
+func (s *weightedSampler) pick(r float64) (k, v []byte, ok bool) {
+	var bl uint64
+	var blockSum float64
+	c := s.wb.Cursor()
+	for bk, bv := c.First(); bk != nil; bk, bv = c.Next() {
+		sum := bytesToWeight(bv) - s.removed[binary.BigEndian.Uint64(bk)]
+		if sum <= 0 {
+			continue
+		}
+		bl, blockSum = binary.BigEndian.Uint64(bk), sum
+		if r < sum {
+			break
+		}
+		r -= sum
+	}
+	if blockSum == 0 {
+		s.total = 0
+		return nil, nil, false
+	}
+	var w float64
+	ec := s.elB.Cursor()
+	for ek, ev := ec.Seek(common.SeqToBytes(bl << countsBlockBits)); ek != nil && block(common.BytesToSeq(ek)) == bl; ek, ev = ec.Next() {
+		if s.picked[string(ek)] {
+			continue
+		}
+		ew := elementWeight(ev, s.field)
+		if ew <= 0 {
+			continue
+		}
+		// the last candidate is taken if the offset is out of the block because of rounding
+		k, v, w = ek, ev, ew
+		if r < ew {
+			break
+		}
+		r -= ew
+	}
+	if k == nil {
+		// only rounding error is left in the block sum
+		s.removed[bl] += blockSum
+		s.total -= blockSum
+		return nil, nil, false
+	}
+	s.picked[string(k)] = true
+	s.removed[bl] += w
+	s.total -= w
+	return k, v, true
+}
+
+// elementWeight returns positive value of the weight field of the encoded element or zero
+func elementWeight(encoded []byte, field string) float64 {
+	var data interface{}
+	if json.Unmarshal(encoded, &data) != nil {
+		return 0
+	}
+	v, _ := common.GetField(data, field)
+	w, ok := common.ToFloat(v)
+	if !ok || w <= 0 || math.IsInf(w, 0) || math.IsNaN(w) {
+		return 0
+	}
+	return w
+}
+
+func weightToBytes(w float64) []byte {
+	return uint64ToBytes(math.Float64bits(w))
+}
+
+func bytesToWeight(b []byte) float64 {
+	return math.Float64frombits(binary.BigEndian.Uint64(b))
+}
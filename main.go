@@ -11,6 +11,7 @@ import (
 	"github.com/getblank/blank-queue/intranet"
 	"github.com/getblank/blank-queue/lists"
 	"github.com/getblank/blank-queue/queue"
+	"github.com/getblank/blank-queue/zsets"
 )
 
 var (
@@ -42,6 +43,7 @@ func main() {
 	port := flag.String("p", "8083", "TCP port to listen")
 	qdbFile := flag.String("q", "queue.db", "Queue database filename")
 	ldbFile := flag.String("l", "lists.db", "Lists database filename")
+	zdbFile := flag.String("z", "zsets.db", "Sorted sets database filename")
 	verFlag := flag.Bool("v", false, "Prints version and exit")
 	flag.Parse()
 
@@ -64,6 +66,7 @@ func main() {
 	log.Info("blank-queue started")
 	go queue.Init(*qdbFile)
 	go lists.Init(*ldbFile)
+	go zsets.Init(*zdbFile)
 	intranet.Init(*srAddress, *port)
 }
 
@@ -0,0 +1,83 @@
+package queue
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/boltdb/bolt"
+
+	"github.com/getblank/blank-queue/common"
+)
+
+// batchPollInterval is the max time to wait for the push notification,
+// because delayed items become visible without any notification
+const batchPollInterval = 100 * time.Millisecond
+
+var (
+	pushNotifier    = common.NewNotifier()
+	errInvalidLimit = errors.New("invalid limit")
+)
+
+func shiftBatch(queue string, limit int, maxWait time.Duration, groupKey string) (items []interface{}, err error) {
+	if limit <= 0 {
+		return nil, errInvalidLimit
+	}
+	var group []byte
+	var grouped bool
+	accept := func(data interface{}) bool {
+		if groupKey == "" {
+			return true
+		}
+		v, _ := common.GetField(data, groupKey)
+		key, err := json.Marshal(v)
+		if err != nil {
+			return false
+		}
+		if !grouped {
+			group, grouped = key, true
+			return true
+		}
+		return bytes.Equal(key, group)
+	}
+	deadline := time.Now().Add(maxWait)
+	for {
+		pushed := pushNotifier.Wait(queue)
+		err = db.Update(func(tx *bolt.Tx) error {
+			b := tx.Bucket([]byte(queue))
+			if b == nil {
+				if maxWait > 0 {
+					return nil
+				}
+				return errQueueIsNotExists
+			}
+			shifted, err := shiftItems(queue, limit-len(items), accept, b)
+			if err != nil {
+				return err
+			}
+			items = append(items, shifted...)
+			return nil
+		})
+		if err != nil && len(items) > 0 {
+			// items shifted by the previous transactions are already removed from the queue and must not be lost
+			log.Errorf("Can't shift batch for queue: %s, returning %d already shifted items, error: %v", queue, len(items), err)
+			return items, nil
+		}
+		if err != nil || len(items) >= limit {
+			return items, err
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return items, nil
+		}
+		if remaining > batchPollInterval {
+			remaining = batchPollInterval
+		}
+		select {
+		case <-pushed:
+		case <-time.After(remaining):
+		}
+	}
+}
@@ -0,0 +1,188 @@
+package queue
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/getblank/blank-queue/common"
+)
+
+// Coalescing modes
+const (
+	// CoalesceReplace keeps only the last pushed item
+	CoalesceReplace = "replace"
+	// CoalesceMerge collects all pushed items into array
+	CoalesceMerge = "merge"
+)
+
+var (
+	coalesceBucket           = []byte("_coalesce")
+	errInvalidCoalesceConfig = errors.New("invalid coalescing options")
+	errCoalescingIDLookup    = errors.New("items of coalescing queue can't be accessed by _id")
+)
+
+// CoalesceOptions describes coalescing mode of the queue.
+// Key is a dot separated path to the item property used as coalescing key,
+// Window is a time in milliseconds while pushed items with the same key will be merged.
+// Items without coalescing key are pushed as usual.
+// Items in coalescing queue are not indexed by _id property, so Get and Remove return error for such queues.
+type CoalesceOptions struct {
+	Key    string  `json:"key"`
+	Window float64 `json:"window"`
+	Mode   string  `json:"mode"`
+}
+
+func (o *CoalesceOptions) validate() error {
+	if o.Key == "" || o.Window <= 0 {
+		return errInvalidCoalesceConfig
+	}
+	switch o.Mode {
+	case "":
+		o.Mode = CoalesceReplace
+	case CoalesceReplace, CoalesceMerge:
+	default:
+		return errInvalidCoalesceConfig
+	}
+	return nil
+}
+
+func (o *CoalesceOptions) key(data interface{}) ([]byte, bool) {
+	if o.Mode == CoalesceMerge {
+		items, ok := data.([]interface{})
+		if !ok || len(items) == 0 {
+			return nil, false
+		}
+		data = items[0]
+	}
+	v, ok := common.GetField(data, o.Key)
+	if !ok {
+		return nil, false
+	}
+	key, err := json.Marshal(v)
+	if err != nil {
+		return nil, false
+	}
+	return key, true
+}
+
+// coalesce merges item with the pending item with the same coalescing key or pushes new delayed item
+func coalesce(queue string, data interface{}, opts *CoalesceOptions, b *bolt.Bucket) error {
+	if opts.Mode == CoalesceMerge {
+		data = []interface{}{data}
+	}
+	key, ok := opts.key(data)
+	if !ok {
+		_, err := putItem(queue, data, nil, 0, b)
+		return err
+	}
+	sb, err := b.CreateBucketIfNotExists(coalesceBucket)
+	if err != nil {
+		return err
+	}
+	// coalescing key refers to the pending item until it is moved to the queue by promoteDelayed
+	dB := b.Bucket(delayedBucket)
+	if dKey := sb.Get(key); dKey != nil && dB != nil {
+		if encoded := dB.Get(dKey); encoded != nil {
+			if opts.Mode == CoalesceMerge {
+				var items []interface{}
+				err = json.Unmarshal(encoded, &items)
+				if err != nil {
+					return err
+				}
+				data = append(items, data.([]interface{})...)
+			}
+			encoded, err = json.Marshal(data)
+			if err != nil {
+				return err
+			}
+			return dB.Put(dKey, encoded)
+		}
+	}
+	visibleAt := time.Now().Add(time.Duration(opts.Window * float64(time.Millisecond))).UnixNano()
+	dKey, err := putItem(queue, data, nil, visibleAt, b)
+	if err != nil {
+		return err
+	}
+	return sb.Put(key, dKey)
+}
+
+// requeueCoalesced stores nacked item of coalescing queue hidden until visibleAt without indexing it by _id.
+// Item takes the coalescing key if there is no pending item with the same key, so items pushed
+// with this key are merged into it as pushTx does.
+func requeueCoalesced(queue string, data interface{}, opts *CoalesceOptions, visibleAt int64, b *bolt.Bucket) error {
+	dKey, err := putItem(queue, data, nil, visibleAt, b)
+	if err != nil {
+		return err
+	}
+	key, ok := opts.key(data)
+	if !ok {
+		return nil
+	}
+	sb, err := b.CreateBucketIfNotExists(coalesceBucket)
+	if err != nil {
+		return err
+	}
+	if pending := sb.Get(key); pending != nil {
+		if dB := b.Bucket(delayedBucket); dB != nil && dB.Get(pending) != nil {
+			return nil
+		}
+	}
+	return sb.Put(key, dKey)
+}
+
+// checkIDLookup returns error if the queue is coalescing and it's items are not indexed by _id
+func checkIDLookup(queue string, b *bolt.Bucket) error {
+	stat, err := getStat(queue, b)
+	if err != nil {
+		return err
+	}
+	if stat.Coalesce != nil {
+		return errCoalescingIDLookup
+	}
+	return nil
+}
+
+// uncoalesce removes coalescing key reference of the pending item which becomes visible
+func uncoalesce(data interface{}, dKey []byte, opts *CoalesceOptions, b *bolt.Bucket) error {
+	sb := b.Bucket(coalesceBucket)
+	if sb == nil {
+		return nil
+	}
+	key, ok := opts.key(data)
+	if !ok {
+		return nil
+	}
+	if !bytes.Equal(sb.Get(key), dKey) {
+		return nil
+	}
+	return sb.Delete(key)
+}
+
+func setCoalescing(queue string, opts *CoalesceOptions) error {
+	if opts != nil {
+		if err := opts.validate(); err != nil {
+			return err
+		}
+	}
+	if isReservedName(queue) {
+		return errReservedQueueName
+	}
+	return db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(queue))
+		if err != nil {
+			return err
+		}
+		stat, err := getStat(queue, b)
+		if err != nil {
+			return err
+		}
+		stat.Lock()
+		defer stat.Unlock()
+		stat.Coalesce = opts
+		return putStat(queue, stat, b)
+	})
+}
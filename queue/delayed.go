@@ -0,0 +1,164 @@
+package queue
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/getblank/blank-queue/common"
+)
+
+var (
+	// delayedBucket stores items hidden from shift outside of the queue FIFO range,
+	// keys are 8 bytes of visibility time (unix nanoseconds) and 8 bytes of the bucket sequence
+	delayedBucket = []byte("_delayed")
+	// delayedIDsBucket stores keys of the delayed items by their _id
+	delayedIDsBucket = []byte("_delayedIDs")
+)
+
+// putDelayed stores item hidden from shift until visibleAt and returns it's key in the delayed bucket.
+// Item with the same id is replaced.
+func putDelayed(queue string, data interface{}, id []byte, visibleAt int64, b *bolt.Bucket) ([]byte, error) {
+	if id != nil {
+		err := removeByID(queue, id, b)
+		if err != nil && err != common.ErrNotFound && err != common.ErrSeqToIDBucket {
+			return nil, err
+		}
+	}
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	dB, err := b.CreateBucketIfNotExists(delayedBucket)
+	if err != nil {
+		return nil, err
+	}
+	n, err := dB.NextSequence()
+	if err != nil {
+		return nil, err
+	}
+	key := make([]byte, 16)
+	binary.BigEndian.PutUint64(key, uint64(visibleAt))
+	binary.BigEndian.PutUint64(key[8:], n)
+	err = dB.Put(key, encoded)
+	if err != nil {
+		return nil, err
+	}
+	if id != nil {
+		idB, err := b.CreateBucketIfNotExists(delayedIDsBucket)
+		if err != nil {
+			return nil, err
+		}
+		err = idB.Put(id, key)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return key, addDelayed(queue, 1, b)
+}
+
+// getDelayed returns encoded delayed item with provided id or nil
+func getDelayed(id []byte, b *bolt.Bucket) []byte {
+	idB, dB := b.Bucket(delayedIDsBucket), b.Bucket(delayedBucket)
+	if idB == nil || dB == nil {
+		return nil
+	}
+	key := idB.Get(id)
+	if key == nil {
+		return nil
+	}
+	return dB.Get(key)
+}
+
+// removeDelayed removes delayed item with provided id. Returns common.ErrNotFound if there is no such item.
+func removeDelayed(queue string, id []byte, b *bolt.Bucket) error {
+	idB, dB := b.Bucket(delayedIDsBucket), b.Bucket(delayedBucket)
+	if idB == nil || dB == nil {
+		return common.ErrNotFound
+	}
+	key := idB.Get(id)
+	if key == nil {
+		return common.ErrNotFound
+	}
+	key = append([]byte(nil), key...)
+	err := idB.Delete(id)
+	if err != nil {
+		return err
+	}
+	err = dB.Delete(key)
+	if err != nil {
+		return err
+	}
+	return addDelayed(queue, -1, b)
+}
+
+// promoteDelayed moves delayed items which became visible before now to the end of the queue
+// in the order of their visibility time
+func promoteDelayed(queue string, now int64, b *bolt.Bucket) error {
+	dB := b.Bucket(delayedBucket)
+	if dB == nil {
+		return nil
+	}
+	var keys, values [][]byte
+	c := dB.Cursor()
+	for k, v := c.First(); k != nil && int64(binary.BigEndian.Uint64(k)) <= now; k, v = c.Next() {
+		keys = append(keys, append([]byte(nil), k...))
+		values = append(values, append([]byte(nil), v...))
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	stat, err := getStat(queue, b)
+	if err != nil {
+		return err
+	}
+	idB := b.Bucket(delayedIDsBucket)
+	for i, key := range keys {
+		var data interface{}
+		err = json.Unmarshal(values[i], &data)
+		if err != nil {
+			return err
+		}
+		err = dB.Delete(key)
+		if err != nil {
+			return err
+		}
+		var id []byte
+		if _id, ok := common.ExtractID(data); ok && idB != nil && bytes.Equal(idB.Get([]byte(_id)), key) {
+			id = []byte(_id)
+			err = idB.Delete(id)
+			if err != nil {
+				return err
+			}
+		}
+		if stat.Coalesce != nil {
+			err = uncoalesce(data, key, stat.Coalesce, b)
+			if err != nil {
+				return err
+			}
+		}
+		err = addDelayed(queue, -1, b)
+		if err != nil {
+			return err
+		}
+		_, err = putItem(queue, data, id, 0, b)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addDelayed changes the number of the delayed items in the queue stat
+func addDelayed(queue string, delta int, b *bolt.Bucket) error {
+	stat, err := getStat(queue, b)
+	if err != nil {
+		return err
+	}
+	stat.Lock()
+	defer stat.Unlock()
+	stat.Delayed = uint64(int64(stat.Delayed) + int64(delta))
+	return putStat(queue, stat, b)
+}
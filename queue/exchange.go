@@ -0,0 +1,218 @@
+package queue
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"path"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/boltdb/bolt"
+
+	"github.com/getblank/blank-queue/common"
+)
+
+// Binding rules
+const (
+	// BindFanout delivers all pushed items to the bound queue
+	BindFanout = "fanout"
+	// BindExact delivers items which Field property is equal to Value
+	BindExact = "exact"
+	// BindPrefix delivers items which routing key starts with Pattern
+	BindPrefix = "prefix"
+	// BindGlob delivers items which routing key matches Pattern, e.g. "orders.*"
+	BindGlob = "glob"
+)
+
+var (
+	exchangesBucket        = []byte("_exchanges")
+	errExchangeIsNotExists = errors.New("exchange is not exists")
+	errInvalidBinding      = errors.New("invalid binding")
+)
+
+// Binding describes rule to deliver items pushed to exchange to the queue
+type Binding struct {
+	Queue   string      `json:"queue"`
+	Rule    string      `json:"rule"`
+	Field   string      `json:"field,omitempty"`
+	Value   interface{} `json:"value,omitempty"`
+	Pattern string      `json:"pattern,omitempty"`
+}
+
+// Bind binds queue to exchange. Existing binding of the same queue will be replaced.
+func Bind(exchange string, binding *Binding) error {
+	log.Debugf("Bind request for exchange: %s, queue: %s", exchange, binding.Queue)
+	return bind(exchange, binding)
+}
+
+// Bindings returns all bindings of the exchange
+func Bindings(exchange string) ([]*Binding, error) {
+	return bindings(exchange)
+}
+
+// PushToExchange adds copies of the item to the end of all queues which bindings match the item.
+// All copies are added in one transaction. Returns names of the queues item was delivered to.
+func PushToExchange(exchange, routingKey string, data interface{}) ([]string, error) {
+	log.Debugf("Push request to exchange: %s", exchange)
+	return pushToExchange(exchange, routingKey, data)
+}
+
+// Unbind removes binding of the queue from exchange
+func Unbind(exchange, queue string) error {
+	log.Debugf("Unbind request for exchange: %s, queue: %s", exchange, queue)
+	return unbind(exchange, queue)
+}
+
+func (bn *Binding) validate() error {
+	if bn.Queue == "" || isReservedName(bn.Queue) {
+		return errInvalidBinding
+	}
+	switch bn.Rule {
+	case BindFanout, BindPrefix:
+	case BindExact:
+		if bn.Field == "" {
+			return errInvalidBinding
+		}
+	case BindGlob:
+		if _, err := path.Match(bn.Pattern, ""); err != nil {
+			return errInvalidBinding
+		}
+	default:
+		return errInvalidBinding
+	}
+	return nil
+}
+
+func (bn *Binding) match(routingKey string, data interface{}) bool {
+	switch bn.Rule {
+	case BindFanout:
+		return true
+	case BindExact:
+		v, ok := common.GetField(data, bn.Field)
+		if !ok {
+			return false
+		}
+		encoded, err := json.Marshal(v)
+		if err != nil {
+			return false
+		}
+		expected, err := json.Marshal(bn.Value)
+		if err != nil {
+			return false
+		}
+		return bytes.Equal(encoded, expected)
+	case BindPrefix:
+		return bytes.HasPrefix([]byte(routingKey), []byte(bn.Pattern))
+	case BindGlob:
+		ok, _ := path.Match(bn.Pattern, routingKey)
+		return ok
+	}
+	return false
+}
+
+func bind(exchange string, binding *Binding) error {
+	if err := binding.validate(); err != nil {
+		return err
+	}
+	if exchange == "" {
+		return errInvalidBinding
+	}
+	encoded, err := json.Marshal(binding)
+	if err != nil {
+		return err
+	}
+	return db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(exchangesBucket)
+		if err != nil {
+			return err
+		}
+		eb, err := b.CreateBucketIfNotExists([]byte(exchange))
+		if err != nil {
+			return err
+		}
+		return eb.Put([]byte(binding.Queue), encoded)
+	})
+}
+
+func bindings(exchange string) (result []*Binding, err error) {
+	err = db.View(func(tx *bolt.Tx) error {
+		result, err = bindingsTx(tx, exchange)
+		return err
+	})
+	return result, err
+}
+
+func bindingsTx(tx *bolt.Tx, exchange string) ([]*Binding, error) {
+	b := tx.Bucket(exchangesBucket)
+	if b == nil {
+		return nil, errExchangeIsNotExists
+	}
+	eb := b.Bucket([]byte(exchange))
+	if eb == nil {
+		return nil, errExchangeIsNotExists
+	}
+	result := []*Binding{}
+	err := eb.ForEach(func(k, v []byte) error {
+		binding := new(Binding)
+		if err := json.Unmarshal(v, binding); err != nil {
+			return err
+		}
+		result = append(result, binding)
+		return nil
+	})
+	return result, err
+}
+
+func pushToExchange(exchange, routingKey string, data interface{}) (queues []string, err error) {
+	queues = []string{}
+	err = db.Update(func(tx *bolt.Tx) error {
+		bindings, err := bindingsTx(tx, exchange)
+		if err != nil {
+			return err
+		}
+		for _, binding := range bindings {
+			if !binding.match(routingKey, data) {
+				continue
+			}
+			queues = append(queues, binding.Queue)
+			err = pushTx(tx, binding.Queue, data)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		// stats of the queues item was pushed to are changed in memory, but not in the database
+		dropCachedStats(queues...)
+		return nil, err
+	}
+	for _, q := range queues {
+		pushNotifier.Notify(q)
+	}
+	return queues, nil
+}
+
+func unbind(exchange, queue string) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(exchangesBucket)
+		if b == nil {
+			return errExchangeIsNotExists
+		}
+		eb := b.Bucket([]byte(exchange))
+		if eb == nil {
+			return errExchangeIsNotExists
+		}
+		if eb.Get([]byte(queue)) == nil {
+			return common.ErrNotFound
+		}
+		err := eb.Delete([]byte(queue))
+		if err != nil {
+			return err
+		}
+		if k, _ := eb.Cursor().First(); k == nil {
+			return b.DeleteBucket([]byte(exchange))
+		}
+		return nil
+	})
+}
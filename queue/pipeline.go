@@ -0,0 +1,291 @@
+package queue
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/boltdb/bolt"
+
+	"github.com/getblank/blank-queue/common"
+)
+
+// Pipeline steps
+const (
+	// StepProject keeps only Fields properties of the item
+	StepProject = "project"
+	// StepRename moves property From to the property To. Parent of From is removed if it becomes empty.
+	StepRename = "rename"
+	// StepFilter drops items which are not matched the Filter
+	StepFilter = "filter"
+	// StepSet sets property Field to the Value
+	StepSet = "set"
+)
+
+// pipelineBatchSize is the max number of items processed by pipeline in one transaction
+const pipelineBatchSize = 100
+
+var (
+	pipelinesBucket    = []byte("_pipelines")
+	pipelines          = map[string]chan struct{}{}
+	pipelinesLocker    = new(sync.Mutex)
+	errInvalidPipeline = errors.New("invalid pipeline")
+)
+
+// Pipeline moves items from the Source queue to the Target queue applying Steps to each item.
+// Shifting from the Source and pushing to the Target are done in one transaction.
+// Steps except filter are applied to the map items only, other items are passed as is.
+type Pipeline struct {
+	Name   string  `json:"name"`
+	Source string  `json:"source"`
+	Target string  `json:"target"`
+	Steps  []*Step `json:"steps"`
+}
+
+// Step is a one transformation of the pipeline
+type Step struct {
+	Op     string                 `json:"op"`
+	Fields []string               `json:"fields,omitempty"`
+	From   string                 `json:"from,omitempty"`
+	To     string                 `json:"to,omitempty"`
+	Filter map[string]interface{} `json:"filter,omitempty"`
+	Field  string                 `json:"field,omitempty"`
+	Value  interface{}            `json:"value,omitempty"`
+}
+
+// CreatePipeline stores pipeline and starts it. Existing pipeline with the same name will be replaced.
+func CreatePipeline(p *Pipeline) error {
+	log.Debugf("Create pipeline request: %s", p.Name)
+	return createPipeline(p)
+}
+
+// Pipelines returns all stored pipelines
+func Pipelines() ([]*Pipeline, error) {
+	return getPipelines()
+}
+
+// RemovePipeline stops and removes pipeline
+func RemovePipeline(name string) error {
+	log.Debugf("Remove pipeline request: %s", name)
+	return removePipeline(name)
+}
+
+func (p *Pipeline) validate() error {
+	if p.Name == "" || p.Source == "" || p.Target == "" || p.Source == p.Target {
+		return errInvalidPipeline
+	}
+	if isReservedName(p.Source) || isReservedName(p.Target) {
+		return errReservedQueueName
+	}
+	for _, s := range p.Steps {
+		if s == nil {
+			return errInvalidPipeline
+		}
+		switch s.Op {
+		case StepProject:
+			if len(s.Fields) == 0 {
+				return errInvalidPipeline
+			}
+		case StepRename:
+			if s.From == "" || s.To == "" {
+				return errInvalidPipeline
+			}
+		case StepFilter:
+			if err := common.ValidateFilter(s.Filter); err != nil {
+				return err
+			}
+		case StepSet:
+			if s.Field == "" {
+				return errInvalidPipeline
+			}
+		default:
+			return errInvalidPipeline
+		}
+	}
+	return nil
+}
+
+// transform applies pipeline steps to the item. Returns false if item was filtered out.
+func (p *Pipeline) transform(data interface{}) (interface{}, bool, error) {
+	for _, s := range p.Steps {
+		if s.Op == StepFilter {
+			ok, err := common.Match(data, s.Filter)
+			if err != nil || !ok {
+				return nil, false, err
+			}
+			continue
+		}
+		m, ok := data.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		switch s.Op {
+		case StepProject:
+			data = common.Project(m, s.Fields)
+		case StepRename:
+			if v, ok := common.GetField(m, s.From); ok {
+				common.DeleteField(m, s.From)
+				common.SetField(m, s.To, v)
+			}
+		case StepSet:
+			common.SetField(m, s.Field, s.Value)
+		}
+	}
+	return data, true, nil
+}
+
+// process moves batch of items from the source queue to the target queue and returns number of shifted items
+func (p *Pipeline) process() (n int, err error) {
+	var pushed bool
+	err = db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(p.Source))
+		if b == nil {
+			return nil
+		}
+		items, err := shiftItems(p.Source, pipelineBatchSize, nil, b)
+		if err != nil {
+			return err
+		}
+		n = len(items)
+		for _, item := range items {
+			data, ok, err := p.transform(item)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+			err = pushTx(tx, p.Target, data)
+			if err != nil {
+				return err
+			}
+			pushed = true
+		}
+		return nil
+	})
+	if err != nil {
+		dropCachedStats(p.Source, p.Target)
+		return 0, err
+	}
+	if pushed {
+		pushNotifier.Notify(p.Target)
+	}
+	return n, nil
+}
+
+func (p *Pipeline) run(stop chan struct{}) {
+	log.Infof("Pipeline %s started", p.Name)
+	for {
+		pushed := pushNotifier.Wait(p.Source)
+		n, err := p.process()
+		if err != nil {
+			log.WithError(err).WithField("pipeline", p.Name).Error("Can't process pipeline items")
+		}
+		if n > 0 {
+			select {
+			case <-stop:
+				log.Infof("Pipeline %s stopped", p.Name)
+				return
+			default:
+				continue
+			}
+		}
+		select {
+		case <-stop:
+			log.Infof("Pipeline %s stopped", p.Name)
+			return
+		case <-pushed:
+		case <-time.After(batchPollInterval):
+		}
+	}
+}
+
+func createPipeline(p *Pipeline) error {
+	if err := p.validate(); err != nil {
+		return err
+	}
+	encoded, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists(pipelinesBucket)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(p.Name), encoded)
+	})
+	if err != nil {
+		return err
+	}
+	startPipeline(p)
+	return nil
+}
+
+func getPipelines() (result []*Pipeline, err error) {
+	result = []*Pipeline{}
+	err = db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket(pipelinesBucket)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			p := new(Pipeline)
+			if err := json.Unmarshal(v, p); err != nil {
+				return err
+			}
+			result = append(result, p)
+			return nil
+		})
+	})
+	return result, err
+}
+
+func removePipeline(name string) error {
+	err := db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(pipelinesBucket)
+		if b == nil || b.Get([]byte(name)) == nil {
+			return common.ErrNotFound
+		}
+		return b.Delete([]byte(name))
+	})
+	if err != nil {
+		return err
+	}
+	stopPipeline(name)
+	return nil
+}
+
+// startPipelines starts all stored pipelines
+func startPipelines() {
+	ps, err := getPipelines()
+	if err != nil {
+		log.WithError(err).Error("Can't load pipelines")
+		return
+	}
+	for _, p := range ps {
+		startPipeline(p)
+	}
+}
+
+func startPipeline(p *Pipeline) {
+	pipelinesLocker.Lock()
+	defer pipelinesLocker.Unlock()
+	if stop, ok := pipelines[p.Name]; ok {
+		close(stop)
+	}
+	stop := make(chan struct{})
+	pipelines[p.Name] = stop
+	go p.run(stop)
+}
+
+func stopPipeline(name string) {
+	pipelinesLocker.Lock()
+	defer pipelinesLocker.Unlock()
+	if stop, ok := pipelines[name]; ok {
+		close(stop)
+		delete(pipelines, name)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"os/signal"
 	"sync"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/boltdb/bolt"
@@ -20,12 +21,16 @@ var (
 	errQueueIsNotExists   = errors.New("queue is not exists")
 	errExistsInQ          = errors.New("item exists in queue")
 	errQueueInTheBegining = errors.New("queue is in the begining")
+	errReservedQueueName  = errors.New("queue name is reserved")
 )
 
 type queueStat struct {
-	Head    uint64   `json:"head"`
-	Tail    uint64   `json:"tail"`
-	Removed []uint64 `json:"removed"`
+	Head     uint64           `json:"head"`
+	Tail     uint64           `json:"tail"`
+	Removed  []uint64         `json:"removed"`
+	Delayed  uint64           `json:"delayed,omitempty"`
+	Retry    *RetryPolicy     `json:"retry,omitempty"`
+	Coalesce *CoalesceOptions `json:"coalesce,omitempty"`
 	sync.Mutex
 }
 
@@ -48,7 +53,17 @@ func Len(queue string) uint64 {
 	}
 	stat.Lock()
 	defer stat.Unlock()
-	return stat.Tail - stat.Head - uint64(len(stat.Removed))
+	return stat.Tail - stat.Head - uint64(len(stat.Removed)) + stat.Delayed
+}
+
+// Nack returns item back to the queue. Item will be available for shift after backoff delay
+// computed from the number of item attempts. If policy is nil, queue retry policy will be used.
+// Attempt number is stored in the _attempt property of the returned item, so nothing is kept for the shifted items.
+// In coalescing queue returned item is not indexed by _id and takes its coalescing key like pushed items.
+// Returns attempt number and delay for the item.
+func Nack(queue string, data interface{}, policy *RetryPolicy) (attempt uint64, delay time.Duration, err error) {
+	log.Debugf("Nack request for queue: %s", queue)
+	return nack(queue, data, policy)
 }
 
 // Push adds item to the end of the queue
@@ -63,12 +78,36 @@ func Remove(queue string, _id string) error {
 	return remove(queue, _id)
 }
 
+// SetRetryPolicy sets default retry policy for the items nacked in the queue
+func SetRetryPolicy(queue string, policy *RetryPolicy) error {
+	log.Debugf("Set retry policy request for queue: %s", queue)
+	return setRetryPolicy(queue, policy)
+}
+
+// SetCoalescing turns queue to the coalescing mode. Pushed items with the same coalescing key
+// will be merged into one item that will be available for shift after the window closes.
+// Nil opts turns coalescing mode off.
+func SetCoalescing(queue string, opts *CoalesceOptions) error {
+	log.Debugf("Set coalescing request for queue: %s", queue)
+	return setCoalescing(queue, opts)
+}
+
 // Shift returns first item from queue with FIFO algorythm
 func Shift(queue string) (interface{}, error) {
 	log.Debugf("Unshift request for queue: %s", queue)
 	return shift(queue)
 }
 
+// ShiftBatch returns up to limit items from queue with FIFO algorythm.
+// If there are not enough items in the queue, it waits for the new items up to maxWait and returns all shifted items.
+// If groupKey is not empty, all returned items have the same value of the groupKey property.
+// Items are shifted by several transactions while waiting, so if shifting fails after some items were shifted,
+// these items are returned without error.
+func ShiftBatch(queue string, limit int, maxWait time.Duration, groupKey string) ([]interface{}, error) {
+	log.Debugf("ShiftBatch request for queue: %s", queue)
+	return shiftBatch(queue, limit, maxWait, groupKey)
+}
+
 // Unshift inserts item to the begining of the queue
 func Unshift(queue string, data interface{}) error {
 	return unshift(queue, data)
@@ -93,9 +132,13 @@ func Init(file string) {
 		}
 	}()
 	log.Info("Queue DB started")
+	startPipelines()
 }
 
 func drop(queue string) (err error) {
+	if isReservedName(queue) {
+		return errReservedQueueName
+	}
 	err = db.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(queue))
 		if b == nil {
@@ -118,6 +161,12 @@ func get(queue, _id string) (data interface{}, err error) {
 		if b == nil {
 			return errQueueIsNotExists
 		}
+		if err := checkIDLookup(queue, b); err != nil {
+			return err
+		}
+		if encoded := getDelayed(id, b); encoded != nil {
+			return json.Unmarshal(encoded, &data)
+		}
 		seqBytes, err := common.GetEncodedSeqByID(queue, id, b)
 		if err != nil {
 			return err
@@ -155,6 +204,21 @@ func getStat(queue string, b *bolt.Bucket) (*queueStat, error) {
 	return stat, err
 }
 
+// dropCachedStats removes cached stats of the queues, so they will be read from the database again.
+// It must be called when transaction which changed stats of several queues is rolled back.
+func dropCachedStats(names ...string) {
+	queuesLocker.Lock()
+	defer queuesLocker.Unlock()
+	for _, name := range names {
+		delete(queues, name)
+	}
+}
+
+// isReservedName reports whether the name is taken by the service buckets stored along with queues
+func isReservedName(queue string) bool {
+	return queue == string(exchangesBucket) || queue == string(pipelinesBucket)
+}
+
 func getStatFromDb(queue string) (stat *queueStat, err error) {
 	err = db.View(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(queue))
@@ -162,10 +226,9 @@ func getStatFromDb(queue string) (stat *queueStat, err error) {
 			stat = &queueStat{Removed: []uint64{}}
 			return nil
 		}
+		stat = &queueStat{Removed: []uint64{}}
 		encoded := b.Get(common.StatBytes)
-		err = json.Unmarshal(encoded, stat)
 		if encoded == nil {
-			stat = &queueStat{Removed: []uint64{}}
 			return nil
 		}
 		return json.Unmarshal(encoded, stat)
@@ -175,52 +238,90 @@ func getStatFromDb(queue string) (stat *queueStat, err error) {
 
 func push(queue string, data interface{}) (err error) {
 	err = db.Update(func(tx *bolt.Tx) error {
-		var b *bolt.Bucket
-		var seq uint64
-		var encoded, id, seqBytes []byte
-		var newQ, itemExists bool
-		if b = tx.Bucket([]byte(queue)); b == nil {
-			b, err = tx.CreateBucket([]byte(queue))
-			if err != nil {
-				return err
-			}
-			newQ = true
-		}
-		if _id, ok := common.ExtractID(data); ok {
-			id = []byte(_id)
-			if seqBytes, _ = common.GetEncodedSeqByID(queue, id, b); seqBytes != nil {
-				itemExists = true
-			}
+		return pushTx(tx, queue, data)
+	})
+	if err != nil {
+		dropCachedStats(queue)
+		return err
+	}
+	pushNotifier.Notify(queue)
+	return nil
+}
+
+// pushTx adds item to the end of the queue inside the passed transaction.
+// Caller must drop cached stat of the queue with dropCachedStats if transaction fails.
+func pushTx(tx *bolt.Tx, queue string, data interface{}) error {
+	if isReservedName(queue) {
+		return errReservedQueueName
+	}
+	b, err := tx.CreateBucketIfNotExists([]byte(queue))
+	if err != nil {
+		return err
+	}
+	stat, err := getStat(queue, b)
+	if err != nil {
+		return err
+	}
+	if stat.Coalesce != nil {
+		return coalesce(queue, data, stat.Coalesce, b)
+	}
+	var id []byte
+	if _id, ok := common.ExtractID(data); ok {
+		id = []byte(_id)
+	}
+	_, err = putItem(queue, data, id, 0, b)
+	return err
+}
+
+// putItem stores item in the end of the queue or replaces item with the same id.
+// Item will be hidden from shift until visibleAt (unix nanoseconds), zero means visible immediately.
+// Returns key of the item in the queue bucket or in the delayed bucket for the hidden item.
+func putItem(queue string, data interface{}, id []byte, visibleAt int64, b *bolt.Bucket) (seqBytes []byte, err error) {
+	if visibleAt != 0 {
+		return putDelayed(queue, data, id, visibleAt, b)
+	}
+	var seq uint64
+	var encoded []byte
+	var itemExists bool
+	stat, err := getStat(queue, b)
+	if err != nil {
+		return nil, err
+	}
+	if id != nil {
+		if seqBytes, _ = common.GetEncodedSeqByID(queue, id, b); seqBytes != nil {
+			itemExists = true
+		} else if err = removeDelayed(queue, id, b); err != nil && err != common.ErrNotFound {
+			return nil, err
 		}
-		if seqBytes == nil {
-			if !newQ {
-				seq, err = b.NextSequence()
-				if err != nil {
-					return err
-				}
+	}
+	if seqBytes == nil {
+		// queue without any pushed items starts from zero sequence
+		if stat.Tail > 0 {
+			seq, err = b.NextSequence()
+			if err != nil {
+				return nil, err
 			}
-			seqBytes = common.SeqToBytes(seq)
-		}
-		encoded, err = json.Marshal(data)
-		if err != nil {
-			return err
-		}
-		err = b.Put(seqBytes, encoded)
-		if err != nil {
-			return err
 		}
-		if !itemExists {
-			if id != nil {
-				err = common.SetSeqToIDRef(seqBytes, id, b)
-				if err != nil {
-					return err
-				}
+		seqBytes = common.SeqToBytes(seq)
+	}
+	encoded, err = json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	err = b.Put(seqBytes, encoded)
+	if err != nil {
+		return nil, err
+	}
+	if !itemExists {
+		if id != nil {
+			err = common.SetSeqToIDRef(seqBytes, id, b)
+			if err != nil {
+				return nil, err
 			}
-			err = setQueueTail(queue, seq+1, b)
 		}
-		return err
-	})
-	return err
+		err = setQueueTail(queue, seq+1, b)
+	}
+	return seqBytes, err
 }
 
 func putStat(queue string, stat *queueStat, b *bolt.Bucket) error {
@@ -238,12 +339,18 @@ func remove(queue string, _id string) error {
 		if b == nil {
 			return errQueueIsNotExists
 		}
+		if err := checkIDLookup(queue, b); err != nil {
+			return err
+		}
 		return removeByID(queue, []byte(_id), b)
 	})
 	return err
 }
 
 func removeByID(queue string, id []byte, b *bolt.Bucket) error {
+	if err := removeDelayed(queue, id, b); err != common.ErrNotFound {
+		return err
+	}
 	seqBytes, err := common.GetEncodedSeqByID(queue, id, b)
 	if err != nil {
 		return err
@@ -277,6 +384,17 @@ func removeByID(queue string, id []byte, b *bolt.Bucket) error {
 	return err
 }
 
+func markRemoved(queue string, seq uint64, b *bolt.Bucket) error {
+	stat, err := getStat(queue, b)
+	if err != nil {
+		return err
+	}
+	stat.Lock()
+	defer stat.Unlock()
+	stat.Removed = append(stat.Removed, seq)
+	return putStat(queue, stat, b)
+}
+
 func removeRef(seq []byte, b *bolt.Bucket) error {
 	sb := b.Bucket(common.SeqToIDBucket)
 	if sb == nil {
@@ -305,6 +423,11 @@ func setQueueHead(queue string, head uint64, b *bolt.Bucket) error {
 	stat.Lock()
 	defer stat.Unlock()
 	stat.Head = head
+	for i := len(stat.Removed) - 1; i >= 0; i-- {
+		if stat.Removed[i] < stat.Head {
+			stat.Removed = append(stat.Removed[:i], stat.Removed[i+1:]...)
+		}
+	}
 	return putStat(queue, stat, b)
 }
 
@@ -321,45 +444,75 @@ func setQueueTail(queue string, tail uint64, b *bolt.Bucket) error {
 
 func shift(queue string) (data interface{}, err error) {
 	err = db.Update(func(tx *bolt.Tx) error {
-		var b *bolt.Bucket
-		var encoded []byte
-		var stat *queueStat
-		b = tx.Bucket([]byte(queue))
+		b := tx.Bucket([]byte(queue))
 		if b == nil {
 			return errQueueIsNotExists
 		}
-		stat, err = getStat(queue, b)
+		items, err := shiftItems(queue, 1, nil, b)
 		if err != nil {
 			return err
 		}
-		for seq := stat.Head; seq <= stat.Tail; seq++ {
-			seqBytes := common.SeqToBytes(seq)
-			encoded = b.Get(seqBytes)
-			if encoded == nil {
-				continue
-			}
-			err = json.Unmarshal(encoded, &data)
-			if err != nil {
-				return err
-			}
-			err = removeRef(seqBytes, b)
-			if err != nil {
-				return err
-			}
-			setQueueHead(queue, seq+1, b)
-			for i := len(stat.Removed) - 1; i >= 0; i-- {
-				if stat.Removed[i] <= stat.Head {
-					stat.Removed = append(stat.Removed[:i], stat.Removed[i+1:]...)
-				}
-			}
-			return nil
+		if len(items) > 0 {
+			data = items[0]
 		}
 		return nil
 	})
 	return data, err
 }
 
+// shiftItems removes up to limit visible items from the begining of the queue and returns them.
+// Items rejected by accept func are left in the queue.
+func shiftItems(queue string, limit int, accept func(interface{}) bool, b *bolt.Bucket) (items []interface{}, err error) {
+	err = promoteDelayed(queue, time.Now().UnixNano(), b)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := getStat(queue, b)
+	if err != nil {
+		return nil, err
+	}
+	var skipped bool
+	for seq := stat.Head; seq <= stat.Tail && len(items) < limit; seq++ {
+		seqBytes := common.SeqToBytes(seq)
+		encoded := b.Get(seqBytes)
+		if encoded == nil {
+			continue
+		}
+		var data interface{}
+		err = json.Unmarshal(encoded, &data)
+		if err != nil {
+			return nil, err
+		}
+		if accept != nil && !accept(data) {
+			skipped = true
+			continue
+		}
+		err = removeRef(seqBytes, b)
+		if err != nil {
+			return nil, err
+		}
+		err = b.Delete(seqBytes)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, data)
+		if skipped {
+			// skipped items are still waiting before this one, so the head must stay on its place
+			err = markRemoved(queue, seq, b)
+		} else {
+			err = setQueueHead(queue, seq+1, b)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return items, nil
+}
+
 func unshift(queue string, data interface{}) (err error) {
+	if isReservedName(queue) {
+		return errReservedQueueName
+	}
 	err = db.Update(func(tx *bolt.Tx) error {
 		var b *bolt.Bucket
 		var encoded, id []byte
@@ -400,5 +553,8 @@ func unshift(queue string, data interface{}) (err error) {
 		}
 		return setQueueHead(queue, stat.Head, b)
 	})
+	if err == nil {
+		pushNotifier.Notify(queue)
+	}
 	return nil
 }
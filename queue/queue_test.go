@@ -1,10 +1,14 @@
 package queue
 
 import (
+	"encoding/json"
 	"os"
 	"testing"
+	"time"
 
+	"github.com/boltdb/bolt"
 	. "github.com/franela/goblin"
+	"github.com/getblank/blank-queue/common"
 )
 
 var fileName = "queue-test.db"
@@ -77,6 +81,51 @@ func Test(t *testing.T) {
 
 	})
 
+	g.Describe("#ShiftBatch", func() {
+		g.It("should return up to limit items", func() {
+			queue := "testShiftBatch"
+			for _, p := range strings {
+				err := Push(queue, p)
+				g.Assert(err == nil).IsTrue()
+			}
+			items, err := ShiftBatch(queue, 4, time.Second, "")
+			g.Assert(err == nil).IsTrue()
+			g.Assert(items).Equal([]interface{}{"0", "1", "2", "3"})
+			items, err = ShiftBatch(queue, 4, 20*time.Millisecond, "")
+			g.Assert(err == nil).IsTrue()
+			g.Assert(items).Equal([]interface{}{"4", "5"})
+			g.Assert(int(Len(queue))).Equal(0)
+		})
+		g.It("should wait for pushed items until limit reached", func() {
+			queue := "testShiftBatchWait"
+			go func() {
+				for _, p := range strings[:3] {
+					time.Sleep(10 * time.Millisecond)
+					Push(queue, p)
+				}
+			}()
+			items, err := ShiftBatch(queue, 3, time.Second, "")
+			g.Assert(err == nil).IsTrue()
+			g.Assert(items).Equal([]interface{}{"0", "1", "2"})
+		})
+		g.It("should return items with the same group key only", func() {
+			queue := "testShiftBatchGroup"
+			for i, p := range maps {
+				err := Push(queue, map[string]interface{}{"_id": p["_id"], "group": i % 2})
+				g.Assert(err == nil).IsTrue()
+			}
+			items, err := ShiftBatch(queue, 5, 0, "group")
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(items)).Equal(3)
+			g.Assert(int(Len(queue))).Equal(2)
+			items, err = ShiftBatch(queue, 5, 0, "group")
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(items)).Equal(2)
+			g.Assert(items[0].(map[string]interface{})["_id"].(string)).Equal("1")
+			g.Assert(int(Len(queue))).Equal(0)
+		})
+	})
+
 	g.Describe("#Unshift", func() {
 		g.It("should insert item to the begining of the queue", func() {
 			queue := "testUnshift"
@@ -170,5 +219,347 @@ func Test(t *testing.T) {
 		})
 	})
 
+	g.Describe("#Nack", func() {
+		g.It("should return item to the queue after backoff delay", func() {
+			queue := "testNack"
+			err := Push(queue, map[string]interface{}{"_id": "1", "data": "11"})
+			g.Assert(err == nil).IsTrue()
+			item, err := Shift(queue)
+			g.Assert(err == nil).IsTrue()
+			policy := &RetryPolicy{Base: 50, Multiplier: 2, Max: 1000}
+			attempt, delay, err := Nack(queue, item, policy)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(attempt).Equal(uint64(1))
+			g.Assert(delay).Equal(50 * time.Millisecond)
+			g.Assert(int(Len(queue))).Equal(1)
+			item, err = Shift(queue)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(item == nil).IsTrue("item must be delayed")
+			time.Sleep(delay)
+			item, err = Shift(queue)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(item.(map[string]interface{})["_id"].(string)).Equal("1")
+
+			attempt, delay, err = Nack(queue, item, policy)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(attempt).Equal(uint64(2))
+			g.Assert(delay).Equal(100 * time.Millisecond)
+		})
+		g.It("should not block items pushed after delayed one", func() {
+			queue := "testNackOrder"
+			err := SetRetryPolicy(queue, &RetryPolicy{Base: 50, Multiplier: 1})
+			g.Assert(err == nil).IsTrue()
+			_, _, err = Nack(queue, maps[0], nil)
+			g.Assert(err == nil).IsTrue()
+			err = Push(queue, maps[1])
+			g.Assert(err == nil).IsTrue()
+			g.Assert(int(Len(queue))).Equal(2)
+			item, err := Shift(queue)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(item.(map[string]interface{})["_id"].(string)).Equal("1")
+			g.Assert(int(Len(queue))).Equal(1)
+			time.Sleep(50 * time.Millisecond)
+			item, err = Shift(queue)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(item.(map[string]interface{})["_id"].(string)).Equal("0")
+			g.Assert(int(Len(queue))).Equal(0)
+		})
+		g.It("should count attempts by the item and start them again for the new item with the same _id", func() {
+			queue := "testNackAttempts"
+			err := SetRetryPolicy(queue, &RetryPolicy{Multiplier: 1})
+			g.Assert(err == nil).IsTrue()
+			attempt, _, err := Nack(queue, maps[0], nil)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(attempt).Equal(uint64(1))
+			_, hasAttempt := maps[0][attemptField]
+			g.Assert(hasAttempt).IsFalse()
+			item, err := Shift(queue)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(item.(map[string]interface{})[attemptField]).Equal(float64(1))
+			attempt, _, err = Nack(queue, item, nil)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(attempt).Equal(uint64(2))
+			Shift(queue)
+			err = Push(queue, maps[0])
+			g.Assert(err == nil).IsTrue()
+			item, _ = Shift(queue)
+			attempt, _, err = Nack(queue, item, nil)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(attempt).Equal(uint64(1))
+		})
+		g.It("should move delayed items out of the queue head", func() {
+			queue := "testNackHead"
+			err := Push(queue, map[string]interface{}{"_id": "delayed"})
+			g.Assert(err == nil).IsTrue()
+			item, _ := Shift(queue)
+			_, _, err = Nack(queue, item, &RetryPolicy{Base: 600000, Multiplier: 1})
+			g.Assert(err == nil).IsTrue()
+			for i := 0; i < 50; i++ {
+				Push(queue, i)
+				_, err = Shift(queue)
+				g.Assert(err == nil).IsTrue()
+			}
+			stat, _ := getStat(queue, nil)
+			g.Assert(len(stat.Removed)).Equal(0)
+			g.Assert(stat.Head).Equal(stat.Tail)
+			g.Assert(int(Len(queue))).Equal(1)
+			item, err = Get(queue, "delayed")
+			g.Assert(err == nil).IsTrue()
+			g.Assert(item.(map[string]interface{})[attemptField]).Equal(float64(1))
+			err = Remove(queue, "delayed")
+			g.Assert(err == nil).IsTrue()
+			g.Assert(int(Len(queue))).Equal(0)
+			_, err = Get(queue, "delayed")
+			g.Assert(err).Equal(common.ErrNotFound)
+		})
+		g.It("should reject unbounded retry policy and cap the delay", func() {
+			err := SetRetryPolicy("testNack", &RetryPolicy{Base: 50, Multiplier: 2})
+			g.Assert(err).Equal(errInvalidRetryPolicy)
+			policy := &RetryPolicy{Base: 1000, Multiplier: 1.5}
+			g.Assert(policy.Delay(10000)).Equal(24 * time.Hour)
+		})
+		g.It("should return error when item has no _id", func() {
+			_, _, err := Nack("testNack", "1", nil)
+			g.Assert(err).Equal(common.ErrNoIDInTheElement)
+		})
+	})
+
+	g.Describe("#SetCoalescing", func() {
+		g.It("should keep last pushed item with the same key and delay it until window closes", func() {
+			queue := "testCoalesceReplace"
+			err := SetCoalescing(queue, &CoalesceOptions{Key: "doc.id", Window: 50})
+			g.Assert(err == nil).IsTrue()
+			for i := 0; i < 3; i++ {
+				err = Push(queue, map[string]interface{}{"doc": map[string]interface{}{"id": "a"}, "v": i})
+				g.Assert(err == nil).IsTrue()
+			}
+			err = Push(queue, map[string]interface{}{"doc": map[string]interface{}{"id": "b"}, "v": 10})
+			g.Assert(err == nil).IsTrue()
+			g.Assert(int(Len(queue))).Equal(2)
+			item, err := Shift(queue)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(item == nil).IsTrue("item must be delayed")
+			time.Sleep(50 * time.Millisecond)
+			item, err = Shift(queue)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(item.(map[string]interface{})["v"].(float64)).Equal(float64(2))
+			item, err = Shift(queue)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(item.(map[string]interface{})["v"].(float64)).Equal(float64(10))
+		})
+		g.It("should merge pushed items with the same key into array", func() {
+			queue := "testCoalesceMerge"
+			err := SetCoalescing(queue, &CoalesceOptions{Key: "id", Window: 50, Mode: CoalesceMerge})
+			g.Assert(err == nil).IsTrue()
+			for i := 0; i < 3; i++ {
+				err = Push(queue, map[string]interface{}{"id": "a", "v": i})
+				g.Assert(err == nil).IsTrue()
+			}
+			time.Sleep(50 * time.Millisecond)
+			item, err := Shift(queue)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(item.([]interface{}))).Equal(3)
+			err = Push(queue, map[string]interface{}{"id": "a", "v": 3})
+			g.Assert(err == nil).IsTrue()
+			g.Assert(int(Len(queue))).Equal(1)
+		})
+		g.It("should reject _id lookups on coalescing queue", func() {
+			queue := "testCoalesceLookup"
+			err := SetCoalescing(queue, &CoalesceOptions{Key: "key", Window: 50})
+			g.Assert(err == nil).IsTrue()
+			err = Push(queue, map[string]interface{}{"_id": "1", "key": "a"})
+			g.Assert(err == nil).IsTrue()
+			_, err = Get(queue, "1")
+			g.Assert(err).Equal(errCoalescingIDLookup)
+			g.Assert(Remove(queue, "1")).Equal(errCoalescingIDLookup)
+			err = SetCoalescing(queue, nil)
+			g.Assert(err == nil).IsTrue()
+			_, err = Get(queue, "1")
+			g.Assert(err != nil && err != errCoalescingIDLookup).IsTrue()
+		})
+		g.It("should coalesce pushed items into the nacked item by the coalescing key", func() {
+			queue := "testCoalesceNack"
+			err := SetCoalescing(queue, &CoalesceOptions{Key: "key", Window: 10})
+			g.Assert(err == nil).IsTrue()
+			err = Push(queue, map[string]interface{}{"_id": "1", "key": "a", "v": 1})
+			g.Assert(err == nil).IsTrue()
+			time.Sleep(10 * time.Millisecond)
+			item, err := Shift(queue)
+			g.Assert(err == nil).IsTrue()
+			_, _, err = Nack(queue, item, &RetryPolicy{Base: 50, Multiplier: 1})
+			g.Assert(err == nil).IsTrue()
+			err = Push(queue, map[string]interface{}{"_id": "2", "key": "a", "v": 2})
+			g.Assert(err == nil).IsTrue()
+			g.Assert(int(Len(queue))).Equal(1)
+			_, err = Get(queue, "1")
+			g.Assert(err).Equal(errCoalescingIDLookup)
+			time.Sleep(50 * time.Millisecond)
+			item, err = Shift(queue)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(item.(map[string]interface{})["v"].(float64)).Equal(float64(2))
+			g.Assert(int(Len(queue))).Equal(0)
+		})
+		g.It("should return error for invalid options", func() {
+			err := SetCoalescing("testCoalesceInvalid", &CoalesceOptions{Key: "id", Window: 10, Mode: "sum"})
+			g.Assert(err).Equal(errInvalidCoalesceConfig)
+		})
+	})
+
+	g.Describe("#PushToExchange", func() {
+		g.It("should deliver item copies to all matched queues", func() {
+			exchange := "testExchange"
+			err := Bind(exchange, &Binding{Queue: "testExchangeAll", Rule: BindFanout})
+			g.Assert(err == nil).IsTrue()
+			err = Bind(exchange, &Binding{Queue: "testExchangeOrders", Rule: BindGlob, Pattern: "orders.*"})
+			g.Assert(err == nil).IsTrue()
+			err = Bind(exchange, &Binding{Queue: "testExchangeUsers", Rule: BindPrefix, Pattern: "users."})
+			g.Assert(err == nil).IsTrue()
+			err = Bind(exchange, &Binding{Queue: "testExchangeVIP", Rule: BindExact, Field: "customer.vip", Value: true})
+			g.Assert(err == nil).IsTrue()
+
+			queues, err := PushToExchange(exchange, "orders.created", map[string]interface{}{"customer": map[string]interface{}{"vip": true}})
+			g.Assert(err == nil).IsTrue()
+			g.Assert(queues).Equal([]string{"testExchangeAll", "testExchangeOrders", "testExchangeVIP"})
+			queues, err = PushToExchange(exchange, "users.created", "user")
+			g.Assert(err == nil).IsTrue()
+			g.Assert(queues).Equal([]string{"testExchangeAll", "testExchangeUsers"})
+			g.Assert(int(Len("testExchangeAll"))).Equal(2)
+			g.Assert(int(Len("testExchangeOrders"))).Equal(1)
+			g.Assert(int(Len("testExchangeUsers"))).Equal(1)
+			g.Assert(int(Len("testExchangeVIP"))).Equal(1)
+		})
+		g.It("should stop delivering to unbound queue", func() {
+			exchange := "testExchange"
+			err := Unbind(exchange, "testExchangeAll")
+			g.Assert(err == nil).IsTrue()
+			bindings, err := Bindings(exchange)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(bindings)).Equal(3)
+			queues, err := PushToExchange(exchange, "users.updated", "user")
+			g.Assert(err == nil).IsTrue()
+			g.Assert(queues).Equal([]string{"testExchangeUsers"})
+		})
+		g.It("should return error when exchange is not exists", func() {
+			_, err := PushToExchange("testExchangeNotExists", "", "data")
+			g.Assert(err).Equal(errExchangeIsNotExists)
+		})
+		g.It("should return error for invalid binding", func() {
+			err := Bind("testExchange", &Binding{Queue: "testExchangeAll", Rule: BindExact})
+			g.Assert(err).Equal(errInvalidBinding)
+			err = Bind("testExchange", &Binding{Queue: "_pipelines", Rule: BindFanout})
+			g.Assert(err).Equal(errInvalidBinding)
+		})
+		g.It("should keep queue stats untouched when one of the pushes fails", func() {
+			exchange := "testExchangeRollback"
+			err := Bind(exchange, &Binding{Queue: "testExchangeRollback", Rule: BindFanout})
+			g.Assert(err == nil).IsTrue()
+			err = db.Update(func(tx *bolt.Tx) error {
+				// binding to the reserved name can't be created with Bind, so it is stored directly
+				encoded, _ := json.Marshal(&Binding{Queue: "_exchanges", Rule: BindFanout})
+				return tx.Bucket(exchangesBucket).Bucket([]byte(exchange)).Put([]byte("~broken"), encoded)
+			})
+			g.Assert(err == nil).IsTrue()
+			_, err = PushToExchange(exchange, "", "data")
+			g.Assert(err).Equal(errReservedQueueName)
+			g.Assert(int(Len("testExchangeRollback"))).Equal(0)
+		})
+	})
+
+	g.Describe("#ReservedNames", func() {
+		g.It("should reject operations on the reserved queue names", func() {
+			g.Assert(Push("_exchanges", "data")).Equal(errReservedQueueName)
+			g.Assert(Drop("_exchanges")).Equal(errReservedQueueName)
+			g.Assert(Unshift("_pipelines", "data")).Equal(errReservedQueueName)
+			g.Assert(SetRetryPolicy("_exchanges", nil)).Equal(errReservedQueueName)
+			_, err := Bindings("testExchange")
+			g.Assert(err == nil).IsTrue()
+		})
+		g.It("should allow other queue names starting with _", func() {
+			queue := "_testUnderscore"
+			g.Assert(Push(queue, "data") == nil).IsTrue()
+			g.Assert(int(Len(queue))).Equal(1)
+			item, err := Shift(queue)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(item).Equal("data")
+		})
+	})
+
+	g.Describe("#CreatePipeline", func() {
+		g.It("should move transformed items from source to target queue", func() {
+			p := &Pipeline{
+				Name:   "testPipeline",
+				Source: "testPipelineSource",
+				Target: "testPipelineTarget",
+				Steps: []*Step{
+					{Op: StepFilter, Filter: map[string]interface{}{"$or": []interface{}{
+						map[string]interface{}{"status": "active"},
+						map[string]interface{}{"score": map[string]interface{}{"$gte": 10}},
+					}}},
+					{Op: StepProject, Fields: []string{"_id", "user.email"}},
+					{Op: StepRename, From: "user.email", To: "email"},
+					{Op: StepSet, Field: "source", Value: "pipeline"},
+				},
+			}
+			err := CreatePipeline(p)
+			g.Assert(err == nil).IsTrue()
+			Push(p.Source, map[string]interface{}{"_id": "1", "status": "active", "user": map[string]interface{}{"email": "a@b.c"}})
+			Push(p.Source, map[string]interface{}{"_id": "2", "status": "blocked", "score": 5})
+			Push(p.Source, map[string]interface{}{"_id": "3", "score": 15})
+			items, err := ShiftBatch(p.Target, 2, time.Second, "")
+			g.Assert(err == nil).IsTrue()
+			g.Assert(items).Equal([]interface{}{
+				map[string]interface{}{"_id": "1", "email": "a@b.c", "source": "pipeline"},
+				map[string]interface{}{"_id": "3", "source": "pipeline"},
+			})
+			g.Assert(int(Len(p.Source))).Equal(0)
+
+			ps, err := Pipelines()
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(ps)).Equal(1)
+			err = RemovePipeline(p.Name)
+			g.Assert(err == nil).IsTrue()
+			err = RemovePipeline(p.Name)
+			g.Assert(err).Equal(common.ErrNotFound)
+		})
+		g.It("should remove parent of the renamed property only when it becomes empty", func() {
+			p := &Pipeline{Steps: []*Step{
+				{Op: StepRename, From: "a.b.c", To: "c"},
+				{Op: StepRename, From: "d.e", To: "e"},
+			}}
+			data, ok, err := p.transform(map[string]interface{}{
+				"a": map[string]interface{}{"b": map[string]interface{}{"c": 1}},
+				"d": map[string]interface{}{"e": 2, "f": 3},
+			})
+			g.Assert(err == nil).IsTrue()
+			g.Assert(ok).IsTrue()
+			g.Assert(data).Equal(map[string]interface{}{"c": 1, "e": 2, "d": map[string]interface{}{"f": 3}})
+		})
+		g.It("should return error for invalid pipeline", func() {
+			err := CreatePipeline(&Pipeline{Name: "testPipelineInvalid", Source: "a", Target: "b", Steps: []*Step{
+				{Op: StepFilter, Filter: map[string]interface{}{"a": map[string]interface{}{"$like": "b"}}},
+			}})
+			g.Assert(err).Equal(common.ErrInvalidFilter)
+			err = CreatePipeline(&Pipeline{Name: "testPipelineInvalid", Source: "a", Target: "_exchanges"})
+			g.Assert(err).Equal(errReservedQueueName)
+			err = CreatePipeline(&Pipeline{Name: "testPipelineInvalid", Source: "_pipelines", Target: "b"})
+			g.Assert(err).Equal(errReservedQueueName)
+		})
+		g.It("should keep source items when the target push fails", func() {
+			p := &Pipeline{Name: "testPipelineBroken", Source: "testPipelineBrokenSource", Target: "_exchanges"}
+			Push(p.Source, "first")
+			Push(p.Source, "second")
+			n, err := p.process()
+			g.Assert(err).Equal(errReservedQueueName)
+			g.Assert(n).Equal(0)
+			g.Assert(int(Len(p.Source))).Equal(2)
+			item, err := Shift(p.Source)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(item).Equal("first")
+			item, err = Shift(p.Source)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(item).Equal("second")
+		})
+	})
+
 	os.Remove(fileName)
 }
@@ -0,0 +1,134 @@
+package queue
+
+import (
+	"errors"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/boltdb/bolt"
+
+	"github.com/getblank/blank-queue/common"
+)
+
+// maxRetryDelay is the upper bound of the backoff delay in milliseconds for policies stored without Max
+const maxRetryDelay = float64(24 * time.Hour / time.Millisecond)
+
+// attemptField is the item property keeping number of the item nacks
+const attemptField = "_attempt"
+
+var (
+	errInvalidRetryPolicy = errors.New("invalid retry policy")
+	defaultRetryPolicy    = &RetryPolicy{Base: 1000, Multiplier: 2, Max: 300000, Jitter: 0.2}
+)
+
+// RetryPolicy describes how long nacked item must wait before it will be available for shift again.
+// Delay for the attempt N is Base * Multiplier^(N-1) milliseconds, but not more than Max milliseconds.
+// Max is required when Multiplier is greater than 1.
+// Jitter is a fraction of the delay from 0 to 1 that will be randomly subtracted from it.
+type RetryPolicy struct {
+	Base       float64 `json:"base"`
+	Multiplier float64 `json:"multiplier"`
+	Max        float64 `json:"max"`
+	Jitter     float64 `json:"jitter"`
+}
+
+// Delay returns backoff delay for the provided attempt number
+func (p *RetryPolicy) Delay(attempt uint64) time.Duration {
+	if attempt == 0 {
+		attempt = 1
+	}
+	d := p.Base * math.Pow(p.Multiplier, float64(attempt-1))
+	if p.Max > 0 && d > p.Max {
+		d = p.Max
+	}
+	if d > maxRetryDelay {
+		d = maxRetryDelay
+	}
+	if p.Jitter > 0 {
+		d -= d * p.Jitter * rand.Float64()
+	}
+	return time.Duration(d * float64(time.Millisecond))
+}
+
+func (p *RetryPolicy) validate() error {
+	if p.Base < 0 || p.Max < 0 || p.Multiplier < 1 || p.Jitter < 0 || p.Jitter > 1 {
+		return errInvalidRetryPolicy
+	}
+	if p.Multiplier > 1 && p.Max == 0 {
+		return errInvalidRetryPolicy
+	}
+	return nil
+}
+
+func nack(queue string, data interface{}, policy *RetryPolicy) (attempt uint64, delay time.Duration, err error) {
+	_id, ok := common.ExtractID(data)
+	if !ok {
+		return 0, 0, common.ErrNoIDInTheElement
+	}
+	if policy != nil {
+		if err = policy.validate(); err != nil {
+			return 0, 0, err
+		}
+	}
+	// item is copied to keep passed data untouched
+	m := data.(map[string]interface{})
+	item := make(map[string]interface{}, len(m)+1)
+	for k, v := range m {
+		item[k] = v
+	}
+	attempt = 1
+	if n, ok := common.ToFloat(m[attemptField]); ok && n >= 1 {
+		attempt = uint64(n) + 1
+	}
+	item[attemptField] = attempt
+	err = db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(queue))
+		if b == nil {
+			return errQueueIsNotExists
+		}
+		stat, err := getStat(queue, b)
+		if err != nil {
+			return err
+		}
+		if policy == nil {
+			policy = stat.Retry
+		}
+		if policy == nil {
+			policy = defaultRetryPolicy
+		}
+		delay = policy.Delay(attempt)
+		visibleAt := time.Now().Add(delay).UnixNano()
+		if stat.Coalesce != nil {
+			return requeueCoalesced(queue, item, stat.Coalesce, visibleAt, b)
+		}
+		_, err = putItem(queue, item, []byte(_id), visibleAt, b)
+		return err
+	})
+	return attempt, delay, err
+}
+
+func setRetryPolicy(queue string, policy *RetryPolicy) error {
+	if policy != nil {
+		if err := policy.validate(); err != nil {
+			return err
+		}
+	}
+	if isReservedName(queue) {
+		return errReservedQueueName
+	}
+	return db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(queue))
+		if err != nil {
+			return err
+		}
+		stat, err := getStat(queue, b)
+		if err != nil {
+			return err
+		}
+		stat.Lock()
+		defer stat.Unlock()
+		stat.Retry = policy
+		return putStat(queue, stat, b)
+	})
+}
@@ -0,0 +1,362 @@
+package zsets
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/signal"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/boltdb/bolt"
+
+	"github.com/getblank/blank-queue/common"
+)
+
+var db *bolt.DB
+
+// sub buckets names
+var (
+	scoresBucket  = []byte("_scores")
+	byScoreBucket = []byte("_byScore")
+)
+
+var (
+	errInvalidLimit = errors.New("invalid limit")
+	errInvalidRange = errors.New("invalid range")
+)
+
+// Member is a sorted set element with it's score
+type Member struct {
+	Element interface{} `json:"element"`
+	Score   float64     `json:"score"`
+}
+
+// Init is the main entrypoint for the package
+func Init(file string) {
+	var err error
+	db, err = bolt.Open(file, 0644, nil)
+	if err != nil {
+		panic(err)
+	}
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, os.Interrupt)
+	go func() {
+		for _ = range signalChan {
+			log.Info("Received an interrupt, need to close sorted sets DB")
+			db.Close()
+			log.Info("App closed")
+			close(signalChan)
+			os.Exit(0)
+		}
+	}()
+	log.Info("Sorted sets DB started")
+}
+
+// Add adds element to the sorted set with provided score or updates element and score if it already exists.
+// Element must have _id property. Returns true if new member was added.
+func Add(set string, score float64, data interface{}) (added bool, err error) {
+	_id, ok := common.ExtractID(data)
+	if !ok {
+		return false, common.ErrNoIDInTheElement
+	}
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return false, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(set))
+		if err != nil {
+			return err
+		}
+		elB, err := b.CreateBucketIfNotExists(common.ElementsBucket)
+		if err != nil {
+			return err
+		}
+		id := []byte(_id)
+		added = elB.Get(id) == nil
+		err = elB.Put(id, encoded)
+		if err != nil {
+			return err
+		}
+		return setScore(b, id, score)
+	})
+	return added, err
+}
+
+// Drop drops sorted set
+func Drop(set string) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		return tx.DeleteBucket([]byte(set))
+	})
+}
+
+// IncrBy increments score of the member with provided _id and returns new score
+func IncrBy(set, _id string, delta float64) (score float64, err error) {
+	err = db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(set))
+		if b == nil {
+			return common.ErrNotFound
+		}
+		id := []byte(_id)
+		v := b.Bucket(scoresBucket).Get(id)
+		if v == nil {
+			return common.ErrNotFound
+		}
+		score = common.BytesToFloat(v) + delta
+		return setScore(b, id, score)
+	})
+	return score, err
+}
+
+// Len returns number of members in the sorted set
+func Len(set string) (l uint64) {
+	db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(set))
+		if b == nil {
+			return common.ErrNotFound
+		}
+		l = uint64(b.Bucket(common.ElementsBucket).Stats().KeyN)
+		return nil
+	})
+	return l
+}
+
+// RangeByRank returns members from start to stop rank inclusive ordered by score.
+// Negative rank counts members from the highest score, -1 is the member with the highest score.
+func RangeByRank(set string, start, stop int) (members []*Member, err error) {
+	members = []*Member{}
+	err = db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(set))
+		if b == nil {
+			return common.ErrNotFound
+		}
+		l := b.Bucket(common.ElementsBucket).Stats().KeyN
+		if start < 0 {
+			start += l
+		}
+		if stop < 0 {
+			stop += l
+		}
+		if start < 0 {
+			start = 0
+		}
+		if stop >= l {
+			stop = l - 1
+		}
+		if start > stop {
+			return nil
+		}
+		c := b.Bucket(byScoreBucket).Cursor()
+		k, _ := c.First()
+		for i := 0; i < start && k != nil; i++ {
+			k, _ = c.Next()
+		}
+		for i := start; i <= stop && k != nil; i++ {
+			m, err := member(b, k)
+			if err != nil {
+				return err
+			}
+			members = append(members, m)
+			k, _ = c.Next()
+		}
+		return nil
+	})
+	return members, err
+}
+
+// RangeByScore returns up to limit members which score is between min and max inclusive.
+// Members are ordered by score from the lowest, or from the highest if reverse is true. Zero limit means no limit.
+func RangeByScore(set string, min, max float64, limit int, reverse bool) (members []*Member, err error) {
+	if limit < 0 {
+		return nil, errInvalidLimit
+	}
+	if min > max {
+		return nil, errInvalidRange
+	}
+	members = []*Member{}
+	err = db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(set))
+		if b == nil {
+			return common.ErrNotFound
+		}
+		return scanByScore(b, min, max, reverse, func(k []byte) (bool, error) {
+			m, err := member(b, k)
+			if err != nil {
+				return false, err
+			}
+			members = append(members, m)
+			return limit == 0 || len(members) < limit, nil
+		})
+	})
+	return members, err
+}
+
+// Rank returns rank of the member with provided _id, the member with the lowest score has zero rank
+func Rank(set, _id string) (rank int, err error) {
+	err = db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(set))
+		if b == nil {
+			return common.ErrNotFound
+		}
+		id := []byte(_id)
+		v := b.Bucket(scoresBucket).Get(id)
+		if v == nil {
+			return common.ErrNotFound
+		}
+		target := scoreKey(v, id)
+		c := b.Bucket(byScoreBucket).Cursor()
+		for k, _ := c.First(); k != nil && bytes.Compare(k, target) < 0; k, _ = c.Next() {
+			rank++
+		}
+		return nil
+	})
+	return rank, err
+}
+
+// Remove removes member with provided _id from the sorted set
+func Remove(set, _id string) error {
+	return db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(set))
+		if b == nil {
+			return common.ErrNotFound
+		}
+		id := []byte(_id)
+		if b.Bucket(common.ElementsBucket).Get(id) == nil {
+			return common.ErrNotFound
+		}
+		return removeMember(b, id)
+	})
+}
+
+// RemoveByScore removes all members which score is between min and max inclusive and returns number of removed members
+func RemoveByScore(set string, min, max float64) (n int, err error) {
+	if min > max {
+		return 0, errInvalidRange
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(set))
+		if b == nil {
+			return common.ErrNotFound
+		}
+		ids := [][]byte{}
+		err := scanByScore(b, min, max, false, func(k []byte) (bool, error) {
+			ids = append(ids, append([]byte(nil), k[8:]...))
+			return true, nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			err = removeMember(b, id)
+			if err != nil {
+				return err
+			}
+		}
+		n = len(ids)
+		return nil
+	})
+	return n, err
+}
+
+// Score returns score of the member with provided _id
+func Score(set, _id string) (score float64, err error) {
+	err = db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(set))
+		if b == nil {
+			return common.ErrNotFound
+		}
+		v := b.Bucket(scoresBucket).Get([]byte(_id))
+		if v == nil {
+			return common.ErrNotFound
+		}
+		score = common.BytesToFloat(v)
+		return nil
+	})
+	return score, err
+}
+
+func member(b *bolt.Bucket, k []byte) (*Member, error) {
+	m := &Member{Score: common.BytesToFloat(k[:8])}
+	err := json.Unmarshal(b.Bucket(common.ElementsBucket).Get(k[8:]), &m.Element)
+	return m, err
+}
+
+func removeMember(b *bolt.Bucket, id []byte) error {
+	sb := b.Bucket(scoresBucket)
+	if v := sb.Get(id); v != nil {
+		err := b.Bucket(byScoreBucket).Delete(scoreKey(v, id))
+		if err != nil {
+			return err
+		}
+	}
+	err := sb.Delete(id)
+	if err != nil {
+		return err
+	}
+	return b.Bucket(common.ElementsBucket).Delete(id)
+}
+
+// scanByScore calls fn for each key of the score index between min and max until fn returns false
+func scanByScore(b *bolt.Bucket, min, max float64, reverse bool, fn func(k []byte) (bool, error)) error {
+	c := b.Bucket(byScoreBucket).Cursor()
+	from, to := common.FloatToBytes(min), common.FloatToBytes(max)
+	var k []byte
+	if reverse {
+		// seek to the first key after max score and step back
+		k, _ = c.Seek(append(to, 0xff))
+		if k == nil {
+			k, _ = c.Last()
+		} else {
+			k, _ = c.Prev()
+		}
+	} else {
+		k, _ = c.Seek(from)
+	}
+	for k != nil {
+		score := k[:8]
+		if bytes.Compare(score, from) < 0 || bytes.Compare(score, to) > 0 {
+			return nil
+		}
+		next, err := fn(k)
+		if err != nil || !next {
+			return err
+		}
+		if reverse {
+			k, _ = c.Prev()
+		} else {
+			k, _ = c.Next()
+		}
+	}
+	return nil
+}
+
+func scoreKey(score, id []byte) []byte {
+	key := make([]byte, 0, len(score)+len(id))
+	key = append(key, score...)
+	return append(key, id...)
+}
+
+// setScore updates member score and score index
+func setScore(b *bolt.Bucket, id []byte, score float64) error {
+	sb, err := b.CreateBucketIfNotExists(scoresBucket)
+	if err != nil {
+		return err
+	}
+	ib, err := b.CreateBucketIfNotExists(byScoreBucket)
+	if err != nil {
+		return err
+	}
+	if v := sb.Get(id); v != nil {
+		err = ib.Delete(scoreKey(v, id))
+		if err != nil {
+			return err
+		}
+	}
+	v := common.FloatToBytes(score)
+	err = sb.Put(id, v)
+	if err != nil {
+		return err
+	}
+	return ib.Put(scoreKey(v, id), []byte{})
+}
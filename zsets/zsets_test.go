@@ -0,0 +1,130 @@
+package zsets
+
+import (
+	"math"
+	"os"
+	"strconv"
+	"testing"
+
+	. "github.com/franela/goblin"
+	"github.com/getblank/blank-queue/common"
+)
+
+var fileName = "zsets-test.db"
+
+func Test(t *testing.T) {
+	g := Goblin(t)
+	os.Remove(fileName)
+	Init(fileName)
+
+	g.Describe("#Add", func() {
+		g.It("should add members and update score of existing member", func() {
+			set := "AddSetTest"
+			added, err := Add(set, 10, map[string]interface{}{"_id": "1"})
+			g.Assert(err == nil).IsTrue()
+			g.Assert(added).IsTrue()
+			added, err = Add(set, -2.5, map[string]interface{}{"_id": "1", "name": "one"})
+			g.Assert(err == nil).IsTrue()
+			g.Assert(added).IsFalse()
+			g.Assert(Len(set)).Equal(uint64(1))
+			score, err := Score(set, "1")
+			g.Assert(err == nil).IsTrue()
+			g.Assert(score).Equal(-2.5)
+		})
+
+		g.It("should return error if element has no _id", func() {
+			_, err := Add("AddSetTest", 1, "data")
+			g.Assert(err).Equal(common.ErrNoIDInTheElement)
+		})
+	})
+
+	g.Describe("#RangeByScore", func() {
+		g.It("should return members ordered by score", func() {
+			set := "RangeSetTest"
+			for _, s := range []float64{5, -1, 3, 10, 0} {
+				Add(set, s, map[string]interface{}{"_id": strconv.FormatFloat(s, 'f', -1, 64)})
+			}
+			members, err := RangeByScore(set, 0, 5, 0, false)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(members)).Equal(3)
+			g.Assert(members[0].Score).Equal(float64(0))
+			g.Assert(members[2].Score).Equal(float64(5))
+			members, err = RangeByScore(set, -100, 100, 2, true)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(members)).Equal(2)
+			g.Assert(members[0].Score).Equal(float64(10))
+			g.Assert(members[1].Score).Equal(float64(5))
+		})
+		g.It("should treat negative zero as zero", func() {
+			set := "RangeNegativeZeroSetTest"
+			Add(set, -1, map[string]interface{}{"_id": "negative"})
+			Add(set, math.Copysign(0, -1), map[string]interface{}{"_id": "zero"})
+			Add(set, 1, map[string]interface{}{"_id": "positive"})
+			members, err := RangeByScore(set, -1, 0, 0, false)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(members)).Equal(2)
+			g.Assert(members[0].Score).Equal(float64(-1))
+			g.Assert(members[1].Score).Equal(float64(0))
+			members, err = RangeByScore(set, 0, 0, 0, false)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(members)).Equal(1)
+			g.Assert(members[0].Element).Equal(map[string]interface{}{"_id": "zero"})
+			members, err = RangeByScore(set, math.Copysign(0, -1), math.Copysign(0, -1), 0, false)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(members)).Equal(1)
+		})
+	})
+
+	g.Describe("#RangeByRank", func() {
+		g.It("should return members by rank", func() {
+			set := "RangeSetTest"
+			members, err := RangeByRank(set, 1, 2)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(len(members)).Equal(2)
+			g.Assert(members[0].Score).Equal(float64(0))
+			g.Assert(members[1].Score).Equal(float64(3))
+			members, err = RangeByRank(set, -2, -1)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(members[0].Score).Equal(float64(5))
+			g.Assert(members[1].Score).Equal(float64(10))
+		})
+	})
+
+	g.Describe("#IncrBy", func() {
+		g.It("should increment score and change rank", func() {
+			set := "IncrSetTest"
+			Add(set, 1, map[string]interface{}{"_id": "a"})
+			Add(set, 2, map[string]interface{}{"_id": "b"})
+			rank, err := Rank(set, "a")
+			g.Assert(err == nil).IsTrue()
+			g.Assert(rank).Equal(0)
+			score, err := IncrBy(set, "a", 5)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(score).Equal(float64(6))
+			rank, _ = Rank(set, "a")
+			g.Assert(rank).Equal(1)
+			_, err = IncrBy(set, "c", 5)
+			g.Assert(err).Equal(common.ErrNotFound)
+		})
+	})
+
+	g.Describe("#RemoveByScore", func() {
+		g.It("should remove members in score range", func() {
+			set := "RemoveSetTest"
+			for i, s := range []float64{1, 2, 3, 4} {
+				Add(set, s, map[string]interface{}{"_id": string(rune('a' + i))})
+			}
+			n, err := RemoveByScore(set, 2, 3)
+			g.Assert(err == nil).IsTrue()
+			g.Assert(n).Equal(2)
+			g.Assert(Len(set)).Equal(uint64(2))
+			err = Remove(set, "a")
+			g.Assert(err == nil).IsTrue()
+			members, _ := RangeByRank(set, 0, -1)
+			g.Assert(len(members)).Equal(1)
+			g.Assert(members[0].Element).Equal(map[string]interface{}{"_id": "d"})
+		})
+	})
+
+	os.Remove(fileName)
+}